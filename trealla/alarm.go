@@ -0,0 +1,387 @@
+package trealla
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// yieldInterval is how often (in milliseconds) a query with pending alarms
+// yields back to the host so that its alarms can be checked.
+const yieldInterval = 10
+
+// alarm interrupts a query, calling goal when it expires.
+type alarm struct {
+	goal  Term
+	query *query
+	at    time.Time
+}
+
+// suspension is a host call that yielded to the host.
+// Its query resumes with the result of wait.
+type suspension struct {
+	wait  func(context.Context) (Term, error)
+	reply string
+}
+
+type alarmer interface {
+	AlarmStart(subq Subquery, after time.Duration, goal Term) int64
+	AlarmStop(id int64) bool
+}
+
+func (pl *prolog) AlarmStart(subq Subquery, after time.Duration, goal Term) int64 {
+	q := pl.subquery(uint32(subq))
+	if q == nil {
+		return 0
+	}
+	id := pl.alarmStart(q, after, goal)
+	// make sure the engine checks back with us
+	pl.pl_yield_at.Call(pl.ctx, uint64(subq), yieldInterval)
+	return id
+}
+
+func (pl *prolog) alarmStart(q *query, after time.Duration, goal Term) int64 {
+	pl.alarmn++
+	id := pl.alarmn
+	pl.alarms[id] = &alarm{
+		goal:  goal,
+		query: q,
+		at:    time.Now().Add(after),
+	}
+	if q.alarms == nil {
+		q.alarms = make(map[int64]struct{})
+	}
+	q.alarms[id] = struct{}{}
+	return id
+}
+
+func (pl *prolog) AlarmStop(id int64) bool {
+	a, ok := pl.alarms[id]
+	if !ok {
+		return false
+	}
+	delete(pl.alarms, id)
+	delete(a.query.alarms, id)
+	return true
+}
+
+func (pl *lockedProlog) AlarmStart(subq Subquery, after time.Duration, goal Term) int64 {
+	return pl.prolog.AlarmStart(subq, after, goal)
+}
+
+func (pl *lockedProlog) AlarmStop(id int64) bool {
+	return pl.prolog.AlarmStop(id)
+}
+
+// resume drives a yielded query until it produces an answer or finishes,
+// waiting on suspended host calls and ringing expired alarms along the way.
+func (q *query) resume(ctx context.Context) error {
+	pl := q.pl
+	for !q.done && q.subquery != 0 {
+		v, err := pl.query_did_yield.Call(pl.ctx, uint64(q.subquery))
+		if err != nil {
+			return err
+		}
+		if uint32(v[0]) == 0 {
+			return nil
+		}
+
+		if err := q.readOutput(); err != nil {
+			return err
+		}
+		if err := q.interrupt(ctx); err != nil {
+			return err
+		}
+		if len(q.alarms) > 0 {
+			if _, err := pl.pl_yield_at.Call(pl.ctx, uint64(q.subquery), yieldInterval); err != nil {
+				return err
+			}
+		}
+
+		leave := pl.mounts.enter(q.scope)
+		ret, err := pl.exec(ctx, pl.pl_redo, uint64(q.subquery))
+		leave()
+		if err != nil {
+			return err
+		}
+		q.done = ret == 0
+	}
+	return nil
+}
+
+// interrupt is called while the query is yielded.
+// It waits for suspended host calls and rings expired alarms.
+func (q *query) interrupt(ctx context.Context) error {
+	for q.suspended != nil && q.suspended.wait != nil {
+		// alarms cut the wait short
+		wctx, cancel := ctx, context.CancelFunc(func() {})
+		if next, ok := q.nextAlarm(); ok {
+			wctx, cancel = context.WithDeadline(ctx, next)
+		}
+		// let other queries use the interpreter while we wait
+		if q.lock {
+			q.pl.mu.Unlock()
+		}
+		result, err := q.suspended.wait(wctx)
+		cut := wctx.Err() != nil
+		cancel()
+		if q.lock {
+			q.pl.mu.Lock()
+		}
+		if q.pl.instance == nil {
+			return io.EOF
+		}
+		if err == nil {
+			reply, err := marshalOps(q.capture(result), q.pl.ops)
+			if err != nil {
+				return err
+			}
+			q.suspended.wait = nil
+			q.suspended.reply = reply
+			break
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("trealla: canceled: %w", err)
+		}
+		if !cut {
+			// a real error, not an alarm going off
+			return err
+		}
+		if err := q.ring(ctx); err != nil {
+			return err
+		}
+	}
+	return q.ring(ctx)
+}
+
+func (q *query) nextAlarm() (time.Time, bool) {
+	var next time.Time
+	for id := range q.alarms {
+		if a, ok := q.pl.alarms[id]; ok && (next.IsZero() || a.at.Before(next)) {
+			next = a.at
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// ring calls the goals of expired alarms.
+// If one throws, the exception is raised in the interrupted query.
+func (q *query) ring(ctx context.Context) error {
+	ids := make([]int64, 0, len(q.alarms))
+	for id := range q.alarms {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	now := time.Now()
+	for _, id := range ids {
+		a, ok := q.pl.alarms[id]
+		if !ok || now.Before(a.at) {
+			continue
+		}
+		q.pl.AlarmStop(id)
+
+		text, err := marshalOps(a.goal, q.pl.ops)
+		if err != nil {
+			return err
+		}
+		if q.pl.debug != nil {
+			q.pl.debug.Println("alarm:", text, "subquery:", q.subquery)
+		}
+		ans, err := q.pl.queryOnce(ctx, text, withGuard(q.limits))
+		q.forward(ans, err)
+		switch ex := err.(type) {
+		case nil, ErrFailure:
+			continue
+		case ErrThrow:
+			ex.Query, ex.Stdout, ex.Stderr = q.goal, q.stdout.String(), q.stderr.String()
+			return ex
+		}
+		return err
+	}
+	return nil
+}
+
+// forward copies the output of a nested query into this query's output.
+func (q *query) forward(ans Answer, err error) {
+	switch ex := err.(type) {
+	case ErrFailure:
+		ans.Stdout, ans.Stderr = ex.Stdout, ex.Stderr
+	case ErrThrow:
+		ans.Stdout, ans.Stderr = ex.Stdout, ex.Stderr
+	}
+	q.stdout.WriteString(ans.Stdout)
+	q.stderr.WriteString(ans.Stderr)
+}
+
+// exec calls a wasm function in a new goroutine, returning early if ctx is canceled.
+func (pl *prolog) exec(ctx context.Context, fn wasmFunc, params ...uint64) (uint32, error) {
+	ch := make(chan error, 2)
+	var ret uint32
+	go func() {
+		defer func() {
+			if ex := recover(); ex != nil {
+				ch <- fmt.Errorf("trealla: panic: %v", ex)
+			}
+		}()
+
+		v, err := fn.Call(pl.ctx, params...)
+		if err == nil {
+			ret = uint32(v[0])
+		}
+		ch <- err
+	}()
+
+	select {
+	case <-ctx.Done():
+		return 0, fmt.Errorf("trealla: canceled: %w", ctx.Err())
+	case err := <-ch:
+		if err != nil {
+			return 0, fmt.Errorf("trealla: query error: %w", err)
+		}
+		return ret, nil
+	}
+}
+
+// native returns the interpreter and calling query of a native predicate.
+func native(pl Prolog, subq Subquery) (*prolog, *query) {
+	var p *prolog
+	switch x := pl.(type) {
+	case *prolog:
+		p = x
+	case *lockedProlog:
+		p = x.prolog
+	}
+	if p == nil {
+		return nil, nil
+	}
+	return p, p.subquery(uint32(subq))
+}
+
+// alarm(+Time, :Goal, -ID)
+func alarm_3(pl Prolog, subquery Subquery, goal Term) Term {
+	g := goal.(Compound)
+	after, ok := seconds(g.Args[0])
+	if !ok {
+		return typeError("number", g.Args[0], g.pi())
+	}
+	switch g.Args[1].(type) {
+	case Atom, Compound:
+	case Variable:
+		return throwTerm(Atom("error").Of(Atom("instantiation_error"), g.pi()))
+	default:
+		return typeError("callable", g.Args[1], g.pi())
+	}
+	id := pl.(alarmer).AlarmStart(subquery, after, g.Args[1])
+	if id == 0 {
+		return systemError(g.pi())
+	}
+	return Atom("alarm").Of(g.Args[0], g.Args[1], id)
+}
+
+// remove_alarm(+ID)
+func remove_alarm_1(pl Prolog, _ Subquery, goal Term) Term {
+	g := goal.(Compound)
+	id, ok := g.Args[0].(int64)
+	if !ok {
+		return typeError("integer", g.Args[0], g.pi())
+	}
+	if !pl.(alarmer).AlarmStop(id) {
+		return existenceError("alarm", id, g.pi())
+	}
+	return goal
+}
+
+// call_with_time_limit(+Time, :Goal)
+// Time is a number of seconds, as in SWI-Prolog. Goal is called once in a nested query,
+// throwing time_limit_exceeded if it takes longer.
+// Goals that block the interpreter, such as sleep/1, can't be interrupted while they block.
+func call_with_time_limit_2(pl Prolog, subquery Subquery, goal Term) Term {
+	g := goal.(Compound)
+	limit, ok := seconds(g.Args[0])
+	if !ok {
+		return typeError("number", g.Args[0], g.pi())
+	}
+	if limit <= 0 {
+		return throwTerm(Atom("time_limit_exceeded"))
+	}
+	host, caller := native(pl, subquery)
+	if caller == nil {
+		return systemError(g.pi())
+	}
+	text, err := marshalOps(g.Args[1], host.ops)
+	if err != nil {
+		return typeError("callable", g.Args[1], g.pi())
+	}
+	ctx := caller.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	// run Goal in a nested query that is interrupted when time's up
+	q := host.start(ctx, "once(("+text+")).", withoutLock, withGuard(caller.limits), withAlarm(limit, throwTerm(Atom("time_limit_exceeded"))))
+	defer q.close()
+	ok = q.Next(ctx)
+	ans, err := q.Current(), q.Err()
+	caller.forward(ans, err)
+	switch ex := err.(type) {
+	case nil:
+	case ErrFailure:
+		return Atom("fail")
+	case ErrThrow:
+		caller.rememberBall(ex.Ball, ex.cause)
+		return throwTerm(ex.Ball)
+	default:
+		return systemError(err.Error())
+	}
+	if !ok {
+		return Atom("fail")
+	}
+
+	var conj Term = Atom("true")
+	bs := ans.Solution.bindings()
+	for i := len(bs) - 1; i >= 0; i-- {
+		eq := Atom("=").Of(Variable{Name: bs[i].name}, bs[i].value)
+		if i == len(bs)-1 {
+			conj = eq
+			continue
+		}
+		conj = Atom(",").Of(eq, conj)
+	}
+	return Atom("call").Of(conj)
+}
+
+// suspend yields the calling query to the host.
+// The query resumes with the result of wait, which is treated like the return value of a [Predicate].
+// wait may be called again if it is interrupted by an alarm, so it should be idempotent.
+func suspend(pl Prolog, subquery Subquery, wait func(context.Context) (Term, error)) Term {
+	_, caller := native(pl, subquery)
+	if caller == nil {
+		return systemError(Atom("suspend"))
+	}
+	caller.suspended = &suspension{wait: wait}
+	return Atom("true")
+}
+
+func seconds(t Term) (time.Duration, bool) {
+	switch x := t.(type) {
+	case int64:
+		return time.Duration(x) * time.Second, true
+	case float64:
+		return time.Duration(x * float64(time.Second)), true
+	}
+	return 0, false
+}
+
+// withAlarm sets an alarm that starts with the query.
+func withAlarm(after time.Duration, goal Term) QueryOption {
+	return func(q *query) {
+		q.pl.alarmStart(q, after, goal)
+	}
+}
+
+var (
+	_ alarmer = (*prolog)(nil)
+	_ alarmer = (*lockedProlog)(nil)
+)
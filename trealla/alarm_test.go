@@ -0,0 +1,166 @@
+package trealla
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// registerNap registers nap/1, which yields to the host for a number of seconds
+// like a Go predicate waiting on I/O.
+func registerNap(t *testing.T, pl Prolog) {
+	t.Helper()
+	err := pl.Register(context.Background(), "nap", 1, func(pl Prolog, subquery Subquery, goal Term) Term {
+		g := goal.(Compound)
+		d, ok := seconds(g.Args[0])
+		if !ok {
+			return typeError("number", g.Args[0], g.pi())
+		}
+		deadline := time.Now().Add(d)
+		return suspend(pl, subquery, func(ctx context.Context) (Term, error) {
+			timer := time.NewTimer(time.Until(deadline))
+			defer timer.Stop()
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-timer.C:
+				return Atom("true"), nil
+			}
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTimeLimit(t *testing.T) {
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerNap(t, pl)
+	ctx := context.Background()
+
+	t.Run("exceeded", func(t *testing.T) {
+		ans, err := pl.QueryOnce(ctx, `catch(call_with_time_limit(0.05, (repeat, fail)), E, true).`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := Atom("time_limit_exceeded"); ans.Solution["E"] != want {
+			t.Error("want:", want, "got:", ans.Solution["E"])
+		}
+	})
+
+	t.Run("bindings and output", func(t *testing.T) {
+		ans, err := pl.QueryOnce(ctx, `call_with_time_limit(1, (X = foo(Y), write(hi))), Y = 1.`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := Atom("foo").Of(int64(1)); !reflect.DeepEqual(ans.Solution["X"], want) {
+			t.Error("want:", want, "got:", ans.Solution["X"])
+		}
+		if ans.Stdout != "hi" {
+			t.Error("unexpected stdout:", ans.Stdout)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		_, err := pl.QueryOnce(ctx, `call_with_time_limit(1, fail).`)
+		if !IsFailure(err) {
+			t.Error("expected failure, got:", err)
+		}
+	})
+
+	t.Run("exception", func(t *testing.T) {
+		_, err := pl.QueryOnce(ctx, `call_with_time_limit(1, throw(ball)).`)
+		var ex ErrThrow
+		if !errors.As(err, &ex) || ex.Ball != Atom("ball") {
+			t.Error("expected throw, got:", err)
+		}
+	})
+
+	t.Run("suspended", func(t *testing.T) {
+		start := time.Now()
+		ans, err := pl.QueryOnce(ctx, `catch(call_with_time_limit(0.05, nap(10)), E, true).`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := Atom("time_limit_exceeded"); ans.Solution["E"] != want {
+			t.Error("want:", want, "got:", ans.Solution["E"])
+		}
+		if took := time.Since(start); took > 5*time.Second {
+			t.Error("sleep wasn't interrupted:", took)
+		}
+	})
+}
+
+func TestTimeLimitAfterThrow(t *testing.T) {
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Trealla's own version must not take over after the first call throws
+	if _, err := pl.QueryOnce(ctx, `call_with_time_limit(1, throw(ball)).`); err == nil {
+		t.Fatal("expected throw")
+	}
+	ans, err := pl.QueryOnce(ctx, `call_with_time_limit(1, X = ok).`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ans.Solution["X"] != Atom("ok") {
+		t.Error("unexpected solution:", ans.Solution)
+	}
+}
+
+func TestAlarm(t *testing.T) {
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerNap(t, pl)
+	ctx := context.Background()
+
+	t.Run("ring", func(t *testing.T) {
+		_, err := pl.QueryOnce(ctx, `alarm(0.01, throw(ring), _), repeat, fail.`)
+		var ex ErrThrow
+		if !errors.As(err, &ex) || ex.Ball != Atom("ring") {
+			t.Error("expected throw, got:", err)
+		}
+	})
+
+	t.Run("remove_alarm", func(t *testing.T) {
+		ans, err := pl.QueryOnce(ctx, `alarm(0.01, throw(ring), ID), remove_alarm(ID), nap(0.05).`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := ans.Solution["ID"].(int64); !ok {
+			t.Error("unexpected alarm ID:", ans.Solution["ID"])
+		}
+	})
+
+	if leftovers := len(pl.(*prolog).alarms); leftovers > 0 {
+		t.Error("alarms weren't cleaned up:", leftovers)
+	}
+}
+
+func TestSuspendCancel(t *testing.T) {
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerNap(t, pl)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = pl.QueryOnce(ctx, `write(hello), nap(10).`)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected deadline exceeded, got:", err)
+	}
+	// interpreter is still usable
+	if _, err := pl.QueryOnce(context.Background(), `true.`); err != nil {
+		t.Error(err)
+	}
+}
@@ -21,8 +21,10 @@ type Answer struct {
 
 type response struct {
 	Answer
-	Status queryStatus
-	Error  json.RawMessage // ball
+	// Solution of Answer, decoded separately to apply the interpreter's depth limit
+	Solution json.RawMessage `json:"answer"`
+	Status   queryStatus
+	Error    json.RawMessage // ball
 }
 
 func (pl *prolog) parse(goal, stdout, stderr string) (Answer, error) {
@@ -73,13 +75,19 @@ func (pl *prolog) parse(goal, stdout, stderr string) (Answer, error) {
 
 	// spew.Dump(resp)
 
+	d := termDecoder{maxDepth: pl.maxDepth, text: pl.textLists}
 	switch resp.Status {
 	case statusSuccess:
+		sub, err := unmarshalSubstitution(resp.Solution, d)
+		if err != nil {
+			return resp.Answer, fmt.Errorf("trealla: decoding error: %w", err)
+		}
+		resp.Answer.Solution = sub
 		return resp.Answer, nil
 	case statusFailure:
 		return resp.Answer, ErrFailure{Query: goal, Stdout: output, Stderr: stderr}
 	case statusError:
-		ball, err := unmarshalTerm(resp.Error)
+		ball, err := unmarshalTerm(resp.Error, d)
 		if err != nil {
 			return resp.Answer, err
 		}
@@ -0,0 +1,141 @@
+package trealla
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// RegisterOption is an optional parameter for [Prolog.Register].
+type RegisterOption func(*registration)
+
+type registration struct {
+	cache *predicateCache
+}
+
+// WithCache memoizes the results of a deterministic native predicate.
+// Results are keyed by the variant of the goal term, so calls with identical arguments hit the cache.
+// At most size results are kept (0 for no limit), each for up to ttl (0 to keep them forever).
+// Exceptions thrown by the predicate are not cached.
+//
+// The cache is shared by clones of the interpreter and replicas of a [Pool].
+// Use [Prolog.InvalidateCache] to clear it.
+func WithCache(size int, ttl time.Duration) RegisterOption {
+	return func(reg *registration) {
+		reg.cache = newPredicateCache(size, ttl)
+	}
+}
+
+type predicateCache struct {
+	size int
+	ttl  time.Duration
+	// the predicate without caching, see wrap
+	proc Predicate
+
+	entries map[string]*list.Element
+	lru     *list.List
+	mu      sync.Mutex
+}
+
+type cacheEntry struct {
+	key     string
+	result  Term
+	expires time.Time
+}
+
+func newPredicateCache(size int, ttl time.Duration) *predicateCache {
+	return &predicateCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (c *predicateCache) wrap(proc Predicate) Predicate {
+	c.proc = proc
+	return func(pl Prolog, subquery Subquery, goal Term) Term {
+		key, err := marshal(goal)
+		if err != nil {
+			return proc(pl, subquery, goal)
+		}
+		if result, ok := c.get(key); ok {
+			return result
+		}
+		result := proc(pl, subquery, goal)
+		if cmp, ok := result.(Compound); ok && cmp.Functor == "throw" && len(cmp.Args) == 1 {
+			return result
+		}
+		c.put(key, result)
+		return result
+	}
+}
+
+// fork returns an empty cache with the same settings and its own copy of the cached predicate.
+func (c *predicateCache) fork() (*predicateCache, Predicate) {
+	fresh := newPredicateCache(c.size, c.ttl)
+	return fresh, fresh.wrap(c.proc)
+}
+
+func (c *predicateCache) get(key string) (Term, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry.result, true
+}
+
+func (c *predicateCache) put(key string, result Term) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := &cacheEntry{key: key, result: result}
+	if c.ttl > 0 {
+		entry.expires = time.Now().Add(c.ttl)
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	if c.size > 0 && c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *predicateCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+	c.lru.Init()
+}
+
+func (pl *prolog) InvalidateCache(pi string) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.invalidateCache(pi)
+}
+
+func (pl *prolog) invalidateCache(pi string) {
+	if cache, ok := pl.caches[pi]; ok {
+		cache.clear()
+	}
+}
+
+func (pl *lockedProlog) InvalidateCache(pi string) {
+	if err := pl.ensure(); err != nil {
+		return
+	}
+	pl.prolog.invalidateCache(pi)
+}
@@ -0,0 +1,98 @@
+package trealla
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegisterCache(t *testing.T) {
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	var calls atomic.Int64
+	square := func(_ Prolog, _ Subquery, goal Term) Term {
+		calls.Add(1)
+		g := goal.(Compound)
+		n, ok := g.Args[0].(int64)
+		if !ok {
+			return typeError("integer", g.Args[0], g.pi())
+		}
+		return Atom("square").Of(n, n*n)
+	}
+	if err := pl.Register(ctx, "square", 2, square, WithCache(2, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(t *testing.T, want int64) {
+		t.Helper()
+		if got := calls.Load(); got != want {
+			t.Errorf("want %d calls, got %d", want, got)
+		}
+	}
+	query := func(t *testing.T, pl Prolog, goal string) {
+		t.Helper()
+		if _, err := pl.QueryOnce(ctx, goal); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("hit", func(t *testing.T) {
+		query(t, pl, `square(3, X), X == 9.`)
+		query(t, pl, `square(3, Y), Y == 9.`)
+		expect(t, 1)
+	})
+
+	t.Run("clone", func(t *testing.T) {
+		clone, err := pl.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer clone.Close()
+		query(t, clone, `square(3, 9).`)
+		// different instantiation, different key
+		expect(t, 2)
+		query(t, clone, `square(3, X), X == 9.`)
+		expect(t, 2)
+	})
+
+	t.Run("exceptions aren't cached", func(t *testing.T) {
+		pl.QueryOnce(ctx, `square(x, _).`)
+		pl.QueryOnce(ctx, `square(x, _).`)
+		expect(t, 4)
+	})
+
+	t.Run("eviction", func(t *testing.T) {
+		calls.Store(0)
+		query(t, pl, `square(4, _).`)
+		query(t, pl, `square(5, _).`)
+		query(t, pl, `square(3, _).`)
+		expect(t, 3)
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		calls.Store(0)
+		query(t, pl, `square(5, _).`)
+		expect(t, 0)
+		pl.InvalidateCache("square/2")
+		query(t, pl, `square(5, _).`)
+		expect(t, 1)
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		if err := pl.Register(ctx, "square", 2, square, WithCache(0, 10*time.Millisecond)); err != nil {
+			t.Fatal(err)
+		}
+		calls.Store(0)
+		query(t, pl, `square(6, _).`)
+		query(t, pl, `square(6, _).`)
+		expect(t, 1)
+		time.Sleep(20 * time.Millisecond)
+		query(t, pl, `square(6, _).`)
+		expect(t, 2)
+	})
+}
@@ -0,0 +1,96 @@
+package trealla
+
+import (
+	"context"
+)
+
+func (pl *prolog) BindChannel(name Atom, ch chan Term) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.instance == nil {
+		return
+	}
+	pl.bindChannel(name, ch)
+}
+
+func (pl *prolog) bindChannel(name Atom, ch chan Term) {
+	if ch == nil {
+		delete(pl.chans, name)
+		return
+	}
+	pl.chans[name] = ch
+}
+
+func (pl *lockedProlog) BindChannel(name Atom, ch chan Term) {
+	if err := pl.ensure(); err != nil {
+		return
+	}
+	pl.prolog.bindChannel(name, ch)
+}
+
+func (pl *prolog) channel(name Term, pi Compound) (chan Term, Term) {
+	atom, ok := name.(Atom)
+	if !ok {
+		if _, ok := name.(Variable); ok {
+			return nil, throwTerm(Atom("error").Of(Atom("instantiation_error"), pi))
+		}
+		return nil, typeError("atom", name, pi)
+	}
+	ch, ok := pl.chans[atom]
+	if !ok {
+		return nil, existenceError("channel", atom, pi)
+	}
+	return ch, nil
+}
+
+// chan_send(+Name, +Term)
+func chan_send_2(pl Prolog, subquery Subquery, goal Term) Term {
+	g := goal.(Compound)
+	host, _ := native(pl, subquery)
+	ch, ex := host.channel(g.Args[0], g.pi())
+	if ex != nil {
+		return ex
+	}
+	msg := g.Args[1]
+	return suspend(pl, subquery, func(ctx context.Context) (result Term, err error) {
+		defer func() {
+			// sending to a closed channel
+			if recover() != nil {
+				result = permissionError("send", g.Args[0], g.pi())
+			}
+		}()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case ch <- msg:
+			return Atom("true"), nil
+		}
+	})
+}
+
+// chan_recv(+Name, -Term)
+func chan_recv_2(pl Prolog, subquery Subquery, goal Term) Term {
+	g := goal.(Compound)
+	host, _ := native(pl, subquery)
+	ch, ex := host.channel(g.Args[0], g.pi())
+	if ex != nil {
+		return ex
+	}
+	return suspend(pl, subquery, func(ctx context.Context) (Term, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return Atom("fail"), nil
+			}
+			// call(( Term = Msg ; chan_recv(Name, Term) ))
+			return Atom("call").Of(
+				Atom(";").Of(
+					Atom("=").Of(g.Args[1], msg),
+					g,
+				),
+			), nil
+		}
+	})
+}
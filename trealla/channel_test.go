@@ -0,0 +1,84 @@
+package trealla
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChannel(t *testing.T) {
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	t.Run("chan_recv", func(t *testing.T) {
+		events := make(chan Term)
+		pl.BindChannel("events", events)
+		defer pl.BindChannel("events", nil)
+		go func() {
+			for i := int64(1); i <= 3; i++ {
+				events <- Atom("event").Of(i)
+			}
+			close(events)
+		}()
+
+		q := pl.Query(ctx, `chan_recv(events, event(X)).`)
+		var got []Term
+		for answer := range q.All(ctx) {
+			got = append(got, answer.Solution["X"])
+		}
+		if err := q.Err(); err != nil {
+			t.Fatal(err)
+		}
+		want := []Term{int64(1), int64(2), int64(3)}
+		if !reflect.DeepEqual(want, got) {
+			t.Error("want:", want, "got:", got)
+		}
+	})
+
+	t.Run("chan_send", func(t *testing.T) {
+		out := make(chan Term, 3)
+		pl.BindChannel("out", out)
+		defer pl.BindChannel("out", nil)
+		_, err := pl.QueryOnce(ctx, `forall(member(X, [a, b, c]), chan_send(out, X)).`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		close(out)
+		var got []Term
+		for x := range out {
+			got = append(got, x)
+		}
+		want := []Term{Atom("a"), Atom("b"), Atom("c")}
+		if !reflect.DeepEqual(want, got) {
+			t.Error("want:", want, "got:", got)
+		}
+	})
+
+	t.Run("unknown channel", func(t *testing.T) {
+		_, err := pl.QueryOnce(ctx, `chan_recv(nope, _).`)
+		var ex ErrThrow
+		if !errors.As(err, &ex) {
+			t.Fatal("expected throw, got:", err)
+		}
+		want := Atom("error").Of(Atom("existence_error").Of(Atom("channel"), Atom("nope")), Atom("/").Of(Atom("chan_recv"), int64(2)))
+		if !reflect.DeepEqual(want, ex.Ball) {
+			t.Error("want:", want, "got:", ex.Ball)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		pl.BindChannel("never", make(chan Term))
+		defer pl.BindChannel("never", nil)
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err := pl.QueryOnce(ctx, `chan_recv(never, X).`)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Error("expected deadline exceeded, got:", err)
+		}
+	})
+}
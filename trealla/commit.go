@@ -0,0 +1,206 @@
+package trealla
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync/atomic"
+)
+
+// writeRequest is a call to Pool.Write waiting for its group to be committed.
+type writeRequest struct {
+	tx    func(Prolog) error
+	state atomic.Int32
+	done  chan error
+	// lead is signaled when this request is handed leadership of the next group
+	lead chan struct{}
+}
+
+const (
+	writePending int32 = iota
+	writeRunning
+	writeCanceled
+)
+
+// Write executes a write transaction like [Pool.WriteTx], coalescing concurrent writes.
+// Transactions that arrive while another group is being committed are run back-to-back on the canonical interpreter,
+// after which the replicas are updated once for the whole group.
+// A transaction that fails is rolled back without affecting the rest of its group.
+// To do so, the transactions before it in the group are run again, so tx may be called more than once
+// and should not have side effects outside of the interpreter.
+// Canceling ctx abandons a transaction that hasn't started yet.
+func (pool *Pool) Write(ctx context.Context, tx func(Prolog) error) error {
+	req := &writeRequest{
+		tx:   tx,
+		done: make(chan error, 1),
+		lead: make(chan struct{}, 1),
+	}
+
+	pool.writeMu.Lock()
+	pool.writes = append(pool.writes, req)
+	lead := !pool.writing
+	pool.writing = true
+	pool.writeMu.Unlock()
+
+	if lead {
+		pool.commitNext()
+		return <-req.done
+	}
+
+	select {
+	case err := <-req.done:
+		return err
+	case <-req.lead:
+		pool.commitNext()
+		return <-req.done
+	case <-ctx.Done():
+		pool.writeMu.Lock()
+		if !req.state.CompareAndSwap(writePending, writeCanceled) {
+			pool.writeMu.Unlock()
+			// too late, already running
+			return <-req.done
+		}
+		pool.writes = slices.DeleteFunc(pool.writes, func(w *writeRequest) bool { return w == req })
+		select {
+		case <-req.lead:
+			// leadership was handed to us, pass it on
+			pool.handoff()
+		default:
+		}
+		pool.writeMu.Unlock()
+		return fmt.Errorf("trealla: canceled: %w", ctx.Err())
+	}
+}
+
+// commitNext commits the pending writes as a group, then hands leadership to the next waiting writer.
+func (pool *Pool) commitNext() {
+	pool.writeMu.Lock()
+	group := pool.writes
+	pool.writes = nil
+	pool.writeMu.Unlock()
+
+	defer func() {
+		threw := recover()
+		if threw != nil {
+			err := fmt.Errorf("trealla: panic while committing writes: %v", threw)
+			for _, req := range group {
+				if req.state.Load() != writeCanceled {
+					// no-op if it was already answered
+					select {
+					case req.done <- err:
+					default:
+					}
+				}
+			}
+		}
+		pool.writeMu.Lock()
+		pool.handoff()
+		pool.writeMu.Unlock()
+	}()
+
+	pool.commitGroup(group)
+}
+
+// handoff passes leadership to the oldest waiting writer, or ends the current run of groups if there are none.
+// The caller must hold pool.writeMu.
+func (pool *Pool) handoff() {
+	if len(pool.writes) == 0 {
+		pool.writing = false
+		return
+	}
+	pool.writes[0].lead <- struct{}{}
+}
+
+func (pool *Pool) commitGroup(group []*writeRequest) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	var run []int
+	for i, req := range group {
+		if req.state.CompareAndSwap(writePending, writeRunning) {
+			run = append(run, i)
+		}
+	}
+	if len(run) == 0 {
+		return
+	}
+
+	canon := pool.canon
+	saved := canon.checkpoint()
+	errs := make([]error, len(group))
+	var ok []int
+	for _, i := range run {
+		if errs[i] = pool.apply(group[i].tx); errs[i] == nil {
+			ok = append(ok, i)
+			continue
+		}
+		ok = pool.replay(saved, group, ok, errs)
+	}
+
+	var err error
+	if len(ok) > 0 {
+		err = pool.commit()
+	}
+	for _, i := range run {
+		if errs[i] == nil {
+			errs[i] = err
+		}
+		group[i].done <- errs[i]
+	}
+}
+
+// replay rolls canon back to the start of a group and runs its successful transactions again,
+// dropping any that fail this time. It returns the transactions that succeeded.
+// The caller must hold pool.mu for writing.
+func (pool *Pool) replay(saved checkpoint, group []*writeRequest, ok []int, errs []error) []int {
+	for {
+		pool.canon.rollback(saved)
+		failed := slices.IndexFunc(ok, func(i int) bool {
+			errs[i] = pool.apply(group[i].tx)
+			return errs[i] != nil
+		})
+		if failed == -1 {
+			return ok
+		}
+		ok = slices.Delete(ok, failed, failed+1)
+	}
+}
+
+// apply runs tx on canon.
+// The caller must hold pool.mu for writing.
+func (pool *Pool) apply(tx func(Prolog) error) (err error) {
+	pl := &lockedProlog{prolog: pool.canon}
+	defer pl.kill()
+	defer func() {
+		if threw := recover(); threw != nil {
+			err = fmt.Errorf("trealla: panic in write transaction: %v", threw)
+		}
+	}()
+	return tx(pl)
+}
+
+// checkpoint is a copy of an interpreter's state, used to roll back failed writes.
+type checkpoint struct {
+	memory    []byte
+	procs     map[string]Predicate
+	operators Operators
+}
+
+func (pl *prolog) checkpoint() checkpoint {
+	buf, _ := pl.memory.Read(0, pl.memory.Size())
+	return checkpoint{
+		memory:    append([]byte(nil), buf...),
+		procs:     maps.Clone(pl.procs),
+		operators: pl.operators,
+	}
+}
+
+// rollback restores a checkpoint.
+// Memory can't shrink, so anything past the end of the checkpoint is left as is.
+func (pl *prolog) rollback(saved checkpoint) {
+	buf, _ := pl.memory.Read(0, pl.memory.Size())
+	copy(buf, saved.memory)
+	pl.procs = saved.procs
+	pl.setOperators(saved.operators)
+}
@@ -0,0 +1,209 @@
+package trealla
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// concurrent_maplist(:Goal, ?List)
+func concurrent_maplist_2(pl Prolog, subquery Subquery, goal Term) Term {
+	g := goal.(Compound)
+	xs, ok := g.Args[1].([]Term)
+	if !ok {
+		// partial list: let maplist/2 deal with it
+		return Atom("call").Of(Atom("maplist").Of(g.Args...))
+	}
+	tasks := make([]Term, len(xs))
+	for i := range xs {
+		tasks[i] = Atom("call").Of(g.Args[0], xs[i])
+	}
+	return concurrently(pl, subquery, tasks)
+}
+
+// concurrent_maplist(:Goal, ?List1, ?List2)
+func concurrent_maplist_3(pl Prolog, subquery Subquery, goal Term) Term {
+	g := goal.(Compound)
+	xs, ok := g.Args[1].([]Term)
+	if !ok {
+		return Atom("call").Of(Atom("maplist").Of(g.Args...))
+	}
+	ys, ok := g.Args[2].([]Term)
+	if !ok {
+		if _, unbound := g.Args[2].(Variable); unbound {
+			// call((length(List2, N), concurrent_maplist(Goal, List1, List2)))
+			return Atom("call").Of(Atom(",").Of(Atom("length").Of(g.Args[2], int64(len(xs))), goal))
+		}
+		return Atom("call").Of(Atom("maplist").Of(g.Args...))
+	}
+	if len(xs) != len(ys) {
+		return Atom("fail")
+	}
+	tasks := make([]Term, len(xs))
+	for i := range xs {
+		tasks[i] = Atom("call").Of(g.Args[0], xs[i], ys[i])
+	}
+	return concurrently(pl, subquery, tasks)
+}
+
+// concurrent_forall(:Cond, :Action)
+func concurrent_forall_2(_ Prolog, _ Subquery, goal Term) Term {
+	g := goal.(Compound)
+	// call((findall(Action, Cond, Actions), '$concurrent'(Actions)))
+	actions := Variable{Name: "_Actions"}
+	return Atom("call").Of(
+		Atom(",").Of(
+			Atom("findall").Of(g.Args[1], g.Args[0], actions),
+			Atom("$concurrent").Of(actions),
+		),
+	)
+}
+
+// '$concurrent'(+Goals)
+func sys_concurrent_1(pl Prolog, subquery Subquery, goal Term) Term {
+	g := goal.(Compound)
+	tasks, ok := g.Args[0].([]Term)
+	if !ok {
+		return typeError("list", g.Args[0], g.pi())
+	}
+	return concurrently(pl, subquery, tasks)
+}
+
+// concurrently calls each of tasks once, in idle replicas of the caller's pool.
+// Bindings made by the tasks are unified back into the caller.
+// Outside of a pool, or if no replicas are idle, tasks are called in sequence by the caller.
+func concurrently(pl Prolog, subquery Subquery, tasks []Term) Term {
+	if len(tasks) == 0 {
+		return Atom("true")
+	}
+	sequential := Atom("call").Of(Atom("maplist").Of(Atom("call"), tasks))
+	host, caller := native(pl, subquery)
+	if host == nil || caller == nil || host.pool == nil {
+		return sequential
+	}
+	replicas := host.pool.borrow(host, len(tasks))
+	if len(replicas) == 0 {
+		return sequential
+	}
+
+	ctx := caller.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	// wait may be called again after an alarm rings, so the tasks are started once and their result is kept
+	var (
+		start, settle sync.Once
+		done          = make(chan struct{})
+		answers       = make([]Answer, len(tasks))
+		errs          = make([]error, len(tasks))
+		failed        error
+		result        Term
+		err           error
+	)
+	return suspend(pl, subquery, func(wctx context.Context) (Term, error) {
+		start.Do(func() {
+			go func() {
+				defer close(done)
+				failed = runTasks(ctx, caller.limits, replicas, tasks, answers, errs)
+				host.pool.giveBack(replicas)
+			}()
+		})
+		select {
+		case <-wctx.Done():
+			return nil, wctx.Err()
+		case <-done:
+		}
+		settle.Do(func() {
+			result, err = settleTasks(ctx, caller, tasks, answers, errs, failed)
+		})
+		return result, err
+	})
+}
+
+// runTasks calls each of tasks in the given replicas, skipping the rest once one fails or throws.
+// It returns the error of the first task that did.
+// Running tasks are left to finish instead of being canceled, so their replicas are idle when given back.
+func runTasks(ctx context.Context, limits *guard, replicas []*prolog, tasks []Term, answers []Answer, errs []error) error {
+	next := make(chan int, len(tasks))
+	for i := range tasks {
+		next <- i
+	}
+	close(next)
+
+	// the first task to fail or throw decides the result
+	var failed error
+	var once sync.Once
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	for _, child := range replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if stop.Load() || ctx.Err() != nil {
+					continue
+				}
+				answers[i], errs[i] = child.QueryOnce(ctx, "call(Task__).", WithBind("Task__", tasks[i]), withGuard(limits))
+				if errs[i] != nil && ctx.Err() == nil {
+					once.Do(func() {
+						failed = errs[i]
+						stop.Store(true)
+					})
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return failed
+}
+
+// settleTasks forwards the output of finished tasks to the caller and unifies their bindings back.
+func settleTasks(ctx context.Context, caller *query, tasks []Term, answers []Answer, errs []error, failed error) (Term, error) {
+	for i, ans := range answers {
+		caller.forward(ans, errs[i])
+	}
+	switch ex := failed.(type) {
+	case nil:
+	case ErrFailure:
+		return Atom("fail"), nil
+	case ErrThrow:
+		caller.rememberBall(ex.Ball, ex.cause)
+		return throwTerm(ex.Ball), nil
+	default:
+		return nil, failed
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	solved := make([]Term, len(tasks))
+	for i, ans := range answers {
+		// keep fresh variables from different replicas apart
+		solved[i] = renameVars(ans.Solution["Task__"], "_C"+strconv.Itoa(i))
+	}
+	// call(Tasks = Solved)
+	return Atom("call").Of(Atom("=").Of(tasks, solved)), nil
+}
+
+// renameVars prefixes the names of the variables in t.
+func renameVars(t Term, prefix string) Term {
+	switch t := t.(type) {
+	case Variable:
+		t.Name = prefix + t.Name
+		return t
+	case Compound:
+		args := make([]Term, len(t.Args))
+		for i, arg := range t.Args {
+			args[i] = renameVars(arg, prefix)
+		}
+		return Compound{Functor: t.Functor, Args: args}
+	case []Term:
+		list := make([]Term, len(t))
+		for i, x := range t {
+			list[i] = renameVars(x, prefix)
+		}
+		return list
+	}
+	return t
+}
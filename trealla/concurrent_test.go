@@ -0,0 +1,116 @@
+package trealla
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestConcurrent(t *testing.T) {
+	ctx := context.Background()
+	pool, err := NewPool(WithPoolSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.WriteTx(func(pl Prolog) error {
+		return pl.ConsultText(ctx, "user", `
+			square(X, Y) :- Y is X * X.
+			positive(X) :- X > 0.
+			boom(3) :- throw(boom).
+			boom(_).
+			busy(N) :- forall(between(1, 20000, _), true), N > 0.
+		`)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	standalone, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := standalone.ConsultText(ctx, "user", `square(X, Y) :- Y is X * X. positive(X) :- X > 0.`); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		goal string
+		want Substitution
+		fail bool
+	}{
+		{
+			name: "maplist/3",
+			goal: `numlist(1, 8, Xs), concurrent_maplist(square, Xs, Ys).`,
+			want: Substitution{"Xs": []Term{int64(1), int64(2), int64(3), int64(4), int64(5), int64(6), int64(7), int64(8)},
+				"Ys": []Term{int64(1), int64(4), int64(9), int64(16), int64(25), int64(36), int64(49), int64(64)}},
+		},
+		{
+			name: "maplist/2",
+			goal: `concurrent_maplist(positive, [1, 2, 3]).`,
+			want: Substitution{},
+		},
+		{
+			name: "maplist/2 failure",
+			goal: `concurrent_maplist(positive, [1, -2, 3]).`,
+			fail: true,
+		},
+		{
+			name: "forall",
+			goal: `concurrent_forall(member(X, [1, 2, 3]), positive(X)).`,
+			want: Substitution{"X": Variable{Name: "X"}},
+		},
+		{
+			name: "empty",
+			goal: `concurrent_maplist(square, [], Ys).`,
+			want: Substitution{"Ys": []Term{}},
+		},
+	}
+	for _, tc := range cases {
+		check := func(t *testing.T, pl Prolog) {
+			ans, err := pl.QueryOnce(ctx, tc.goal)
+			if tc.fail {
+				if !IsFailure(err) {
+					t.Error("want failure, got:", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.want, ans.Solution) {
+				t.Error("want:", tc.want, "got:", ans.Solution)
+			}
+		}
+		t.Run(tc.name, func(t *testing.T) {
+			pool.ReadTx(func(pl Prolog) error {
+				check(t, pl)
+				return nil
+			})
+		})
+		t.Run(tc.name+" standalone", func(t *testing.T) {
+			check(t, standalone)
+		})
+	}
+
+	t.Run("throw", func(t *testing.T) {
+		pool.ReadTx(func(pl Prolog) error {
+			_, err := pl.QueryOnce(ctx, `catch(concurrent_forall(between(1, 5, X), boom(X)), Ball, true), Ball == boom.`)
+			if err != nil {
+				t.Error(err)
+			}
+			return nil
+		})
+	})
+	t.Run("alarm while waiting", func(t *testing.T) {
+		pool.ReadTx(func(pl Prolog) error {
+			// the alarm rings while the tasks run, they must not be started again
+			ans, err := pl.QueryOnce(ctx, `alarm(0.001, true, _), numlist(1, 8, Ns), concurrent_maplist(busy, Ns), X = ok.`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ans.Solution["X"] != Atom("ok") {
+				t.Error("unexpected solution:", ans.Solution)
+			}
+			return nil
+		})
+	})
+}
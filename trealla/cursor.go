@@ -0,0 +1,344 @@
+package trealla
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCursorTTL is how long cursors live between fetches by default.
+	defaultCursorTTL = 5 * time.Minute
+	// defaultCursorLimit is the default maximum number of open cursors per owner.
+	defaultCursorLimit = 16
+)
+
+var (
+	// ErrCursorNotFound is returned when fetching a cursor that doesn't exist,
+	// either because it was exhausted, closed, or expired.
+	ErrCursorNotFound = errors.New("trealla: cursor not found")
+	// ErrTooManyCursors is returned when an owner has too many open cursors (see [WithCursorLimit]),
+	// or when a [Pool] has no replica to spare for another cursor.
+	ErrTooManyCursors = errors.New("trealla: too many open cursors")
+)
+
+// CursorOption is an optional parameter for opening cursors.
+type CursorOption func(*cursorConfig)
+
+type cursorConfig struct {
+	owner   string
+	options []QueryOption
+}
+
+// WithCursorOwner sets the owner of a cursor, used to enforce [WithCursorLimit].
+func WithCursorOwner(owner string) CursorOption {
+	return func(cfg *cursorConfig) {
+		cfg.owner = owner
+	}
+}
+
+// WithCursorQueryOptions passes options to the cursor's underlying query.
+func WithCursorQueryOptions(options ...QueryOption) CursorOption {
+	return func(cfg *cursorConfig) {
+		cfg.options = append(cfg.options, options...)
+	}
+}
+
+// WithCursorTTL sets how long cursors are kept alive between fetches.
+// Expired cursors are closed. Default is 5 minutes.
+// For pools, pass this with [WithPoolPrologOption].
+func WithCursorTTL(ttl time.Duration) Option {
+	return func(pl *prolog) {
+		pl.cursorTTL = ttl
+	}
+}
+
+// WithCursorLimit sets the maximum number of open cursors per owner.
+// Default is 16. Set to 0 to disable the limit.
+// For pools, pass this with [WithPoolPrologOption].
+func WithCursorLimit(perOwner int) Option {
+	return func(pl *prolog) {
+		pl.cursorLimit = perOwner
+	}
+}
+
+// cursor is a query that lives across fetches.
+type cursor struct {
+	id    string
+	owner string
+	query Query
+	// query.Current holds an answer that hasn't been fetched yet
+	pending bool
+	// release is called when the cursor is closed
+	release func()
+	timer   *time.Timer
+	closed  bool
+	mu      sync.Mutex
+}
+
+type cursorRegistry struct {
+	ttl time.Duration
+	// limit is the maximum number of cursors per owner, and max the maximum overall (0 for no limit).
+	// A negative max allows no cursors at all.
+	limit   int
+	max     int
+	total   int
+	cursors map[string]*cursor
+	owners  map[string]int
+	mu      sync.Mutex
+}
+
+func newCursorRegistry(ttl time.Duration, limit, max int) *cursorRegistry {
+	if ttl <= 0 {
+		ttl = defaultCursorTTL
+	}
+	return &cursorRegistry{
+		ttl:     ttl,
+		limit:   limit,
+		max:     max,
+		cursors: make(map[string]*cursor),
+		owners:  make(map[string]int),
+	}
+}
+
+// open starts a cursor using the query returned by start.
+// release (which may be nil) is called when the cursor is closed.
+func (r *cursorRegistry) open(ctx context.Context, owner string, start func() (Query, func(), error)) (string, error) {
+	if err := r.reserve(owner); err != nil {
+		return "", err
+	}
+	q, release, err := start()
+	if err != nil {
+		r.unreserve(owner)
+		return "", err
+	}
+	c := &cursor{
+		owner:   owner,
+		query:   q,
+		release: release,
+	}
+
+	// fetch the first answer early to catch errors in the goal
+	c.pending = q.Next(ctx)
+	if err := q.Err(); err != nil && !IsFailure(err) {
+		c.close()
+		r.unreserve(owner)
+		return "", err
+	}
+
+	id, err := newCursorID()
+	if err != nil {
+		c.close()
+		r.unreserve(owner)
+		return "", err
+	}
+	c.id = id
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cursors[id] = c
+	c.timer = time.AfterFunc(r.ttl, func() {
+		r.close(id)
+	})
+	return id, nil
+}
+
+func (r *cursorRegistry) reserve(owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.limit > 0 && r.owners[owner] >= r.limit {
+		return ErrTooManyCursors
+	}
+	if r.max < 0 || (r.max > 0 && r.total >= r.max) {
+		return ErrTooManyCursors
+	}
+	r.owners[owner]++
+	r.total++
+	return nil
+}
+
+func (r *cursorRegistry) unreserve(owner string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.owners[owner]--
+	r.total--
+	if r.owners[owner] <= 0 {
+		delete(r.owners, owner)
+	}
+}
+
+// fetch returns up to n answers, and whether more answers remain.
+// Exhausted cursors are closed.
+func (r *cursorRegistry) fetch(ctx context.Context, id string, n int) ([]Answer, bool, error) {
+	r.mu.Lock()
+	c, ok := r.cursors[id]
+	r.mu.Unlock()
+	if !ok {
+		return nil, false, ErrCursorNotFound
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, false, ErrCursorNotFound
+	}
+	c.timer.Stop()
+	answers := make([]Answer, 0, min(n, 64))
+	for len(answers) < n && c.pending {
+		answers = append(answers, c.query.Current())
+		c.pending = c.query.Next(ctx)
+	}
+	err := c.query.Err()
+	if IsFailure(err) {
+		err = nil
+	}
+	more := c.pending && err == nil
+	if more {
+		c.timer.Reset(r.ttl)
+	}
+	c.mu.Unlock()
+
+	if !more {
+		r.close(id)
+	}
+	return answers, more, err
+}
+
+// close closes a cursor, reporting whether it existed.
+func (r *cursorRegistry) close(id string) bool {
+	r.mu.Lock()
+	c, ok := r.cursors[id]
+	if ok {
+		delete(r.cursors, id)
+	}
+	r.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timer.Stop()
+	c.close()
+	r.unreserve(c.owner)
+	return true
+}
+
+func (c *cursor) close() {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.query.Close()
+	if c.release != nil {
+		c.release()
+	}
+}
+
+func newCursorID() (string, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", fmt.Errorf("trealla: failed to generate cursor ID: %w", err)
+	}
+	return hex.EncodeToString(id[:]), nil
+}
+
+func (pl *prolog) Open(ctx context.Context, goal string, options ...CursorOption) (string, error) {
+	var cfg cursorConfig
+	for _, opt := range options {
+		opt(&cfg)
+	}
+	return pl.cursors.open(ctx, cfg.owner, func() (Query, func(), error) {
+		return pl.Query(ctx, goal, cfg.options...), nil, nil
+	})
+}
+
+func (pl *prolog) Fetch(ctx context.Context, id string, n int) ([]Answer, bool, error) {
+	return pl.cursors.fetch(ctx, id, n)
+}
+
+func (pl *prolog) CloseCursor(id string) bool {
+	return pl.cursors.close(id)
+}
+
+// errCursorInPredicate is returned when using cursors from within a native predicate,
+// as they outlive the call.
+var errCursorInPredicate = errors.New("trealla: cursors can't be used within native predicates")
+
+func (pl *lockedProlog) Open(context.Context, string, ...CursorOption) (string, error) {
+	return "", errCursorInPredicate
+}
+
+func (pl *lockedProlog) Fetch(context.Context, string, int) ([]Answer, bool, error) {
+	return nil, false, errCursorInPredicate
+}
+
+func (pl *lockedProlog) CloseCursor(string) bool {
+	return false
+}
+
+// Open starts a query in a replica and returns a cursor ID for it, to be used with [Pool.Fetch].
+// The replica is reserved for the cursor until it is exhausted, closed, or expires.
+// At most size-1 cursors can be open at once so that a replica is always left for other readers;
+// beyond that, and for pools of one replica, Open returns [ErrTooManyCursors].
+// Cursors see the knowledgebase as it was when they were opened; later write transactions
+// are applied to their replica once it is released.
+func (pool *Pool) Open(ctx context.Context, goal string, options ...CursorOption) (string, error) {
+	var cfg cursorConfig
+	for _, opt := range options {
+		opt(&cfg)
+	}
+	return pool.cursors.open(ctx, cfg.owner, func() (Query, func(), error) {
+		pool.mu.RLock()
+		defer pool.mu.RUnlock()
+		var child *prolog
+		select {
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("trealla: canceled: %w", ctx.Err())
+		case child = <-pool.idle:
+		}
+		if err := pool.refresh(child); err != nil {
+			pool.done(child)
+			return nil, nil, err
+		}
+		pool.hold(child)
+		q := child.Query(ctx, goal, cfg.options...)
+		return q, func() { pool.release(child) }, nil
+	})
+}
+
+// Fetch returns up to n answers from the cursor with the given ID, and whether more answers remain.
+// Exhausted cursors are closed automatically.
+func (pool *Pool) Fetch(ctx context.Context, id string, n int) ([]Answer, bool, error) {
+	return pool.cursors.fetch(ctx, id, n)
+}
+
+// CloseCursor closes the cursor with the given ID, releasing its replica.
+// It reports whether the cursor existed.
+func (pool *Pool) CloseCursor(id string) bool {
+	return pool.cursors.close(id)
+}
+
+// hold marks child as being used by a cursor.
+func (pool *Pool) hold(child *prolog) {
+	pool.heldMu.Lock()
+	defer pool.heldMu.Unlock()
+	pool.held[child] = struct{}{}
+}
+
+// release returns a child used by a cursor to the pool, catching it up with writes it missed.
+func (pool *Pool) release(child *prolog) {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	pool.heldMu.Lock()
+	delete(pool.held, child)
+	pool.heldMu.Unlock()
+	if err := pool.refresh(child); err != nil {
+		panic(err)
+	}
+	pool.done(child)
+}
@@ -0,0 +1,191 @@
+package trealla
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	pl, err := New(WithCursorLimit(1), WithCursorTTL(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	xs := func(answers []Answer) []Term {
+		var got []Term
+		for _, ans := range answers {
+			got = append(got, ans.Solution["X"])
+		}
+		return got
+	}
+
+	t.Run("pagination", func(t *testing.T) {
+		id, err := pl.Open(ctx, `between(1, 5, X).`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages := []struct {
+			want []Term
+			more bool
+		}{
+			{[]Term{int64(1), int64(2)}, true},
+			{[]Term{int64(3), int64(4)}, true},
+			{[]Term{int64(5)}, false},
+		}
+		for _, page := range pages {
+			answers, more, err := pl.Fetch(ctx, id, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := xs(answers); !reflect.DeepEqual(page.want, got) || more != page.more {
+				t.Error("want:", page.want, page.more, "got:", got, more)
+			}
+		}
+		if _, _, err := pl.Fetch(ctx, id, 2); !errors.Is(err, ErrCursorNotFound) {
+			t.Error("expected ErrCursorNotFound, got:", err)
+		}
+	})
+
+	t.Run("exact page", func(t *testing.T) {
+		id, err := pl.Open(ctx, `member(X, [a, b]).`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		answers, more, err := pl.Fetch(ctx, id, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(answers) != 2 || more {
+			t.Error("unexpected page:", answers, more)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		id, err := pl.Open(ctx, `fail.`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		answers, more, err := pl.Fetch(ctx, id, 10)
+		if err != nil || len(answers) != 0 || more {
+			t.Error("unexpected page:", answers, more, err)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := pl.Open(ctx, `throw(ball).`)
+		var ex ErrThrow
+		if !errors.As(err, &ex) {
+			t.Error("expected throw, got:", err)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		id, err := pl.Open(ctx, `repeat.`, WithCursorOwner("alice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pl.Open(ctx, `repeat.`, WithCursorOwner("alice")); !errors.Is(err, ErrTooManyCursors) {
+			t.Error("expected ErrTooManyCursors, got:", err)
+		}
+		other, err := pl.Open(ctx, `repeat.`, WithCursorOwner("bob"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pl.CloseCursor(other)
+		if !pl.CloseCursor(id) {
+			t.Error("cursor didn't exist")
+		}
+		id, err = pl.Open(ctx, `repeat.`, WithCursorOwner("alice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pl.CloseCursor(id)
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		id, err := pl.Open(ctx, `repeat.`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(100 * time.Millisecond)
+		if _, _, err := pl.Fetch(ctx, id, 1); !errors.Is(err, ErrCursorNotFound) {
+			t.Error("expected ErrCursorNotFound, got:", err)
+		}
+		if open := pl.OpenQueries(); len(open) != 0 {
+			t.Error("expired cursor left open queries:", open)
+		}
+	})
+}
+
+func TestPoolCursor(t *testing.T) {
+	pool, err := NewPool(WithPoolSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := pool.WriteTx(func(pl Prolog) error {
+		return pl.ConsultText(ctx, "user", `n(1). n(2). n(3).`)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := pool.Open(ctx, `n(X).`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := pool.Fetch(ctx, id, 1); err != nil {
+		t.Fatal(err)
+	}
+	// the last replica is left for readers
+	if _, err := pool.Open(ctx, `n(X).`, WithCursorOwner("other")); !errors.Is(err, ErrTooManyCursors) {
+		t.Error("expected ErrTooManyCursors, got:", err)
+	}
+
+	// doesn't disturb the cursor's replica
+	if err := pool.WriteTx(func(pl Prolog) error {
+		_, err := pl.QueryOnce(ctx, `assertz(n(4)).`)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	answers, more, err := pool.Fetch(ctx, id, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(answers) != 2 || more {
+		t.Error("unexpected page:", answers, more)
+	}
+
+	// replica caught up after being released
+	if err := pool.ReadTx(func(pl Prolog) error {
+		_, err := pl.QueryOnce(ctx, `n(4).`)
+		return err
+	}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPoolCursorSingleReplica(t *testing.T) {
+	pool, err := NewPool(WithPoolSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := pool.Open(ctx, `true.`); !errors.Is(err, ErrTooManyCursors) {
+		t.Error("expected ErrTooManyCursors, got:", err)
+	}
+	// readers still get the replica
+	if err := pool.ReadTx(func(pl Prolog) error {
+		_, err := pl.QueryOnce(ctx, `true.`)
+		return err
+	}); err != nil {
+		t.Error(err)
+	}
+}
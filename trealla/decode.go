@@ -3,8 +3,11 @@ package trealla
 import (
 	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var (
@@ -12,6 +15,11 @@ var (
 	functorType  = reflect.TypeFor[Functor]()
 	termType     = reflect.TypeFor[Term]()
 	atomType     = reflect.TypeFor[Atom]()
+	anyType      = reflect.TypeFor[any]()
+	charsType    = reflect.TypeFor[Chars]()
+	codesType    = reflect.TypeFor[Codes]()
+	runesType    = reflect.TypeFor[[]rune]()
+	int64Type    = reflect.TypeFor[int64]()
 )
 
 func scan(sub Substitution, rv reflect.Value) error {
@@ -19,6 +27,11 @@ func scan(sub Substitution, rv reflect.Value) error {
 	case reflect.Map:
 		vtype := rv.Type().Elem()
 		for k, v := range sub {
+			if vtype == anyType {
+				n := natural(v)
+				rv.SetMapIndex(reflect.ValueOf(k), reflect.ValueOf(&n).Elem())
+				continue
+			}
 			vv := reflect.ValueOf(v)
 			if !vv.CanConvert(vtype) {
 				return fmt.Errorf("trealla: invalid element type for Scan: %v", vtype)
@@ -51,33 +64,108 @@ func scan(sub Substitution, rv reflect.Value) error {
 			return fmt.Errorf("trealla: must pass pointer to struct or map for Scan. got: %v", rv.Type())
 		}
 
-		rtype := rv.Type()
-		fieldnum := rtype.NumField()
-		fields := make(map[string]reflect.Value, fieldnum)
-		info := make(map[string]reflect.StructField, fieldnum)
-		for i := 0; i < fieldnum; i++ {
-			f := rtype.Field(i)
-			name := f.Name
-			if tag := f.Tag.Get("prolog"); tag != "" {
-				name = tag
-			}
-			fields[name] = rv.Field(i)
-			info[name] = f
+		var errs []FieldError
+		scanStruct(sub, rv, "", &errs)
+		if len(errs) > 0 {
+			return ScanError{Type: rv.Type(), Fields: errs}
 		}
+		return nil
+	}
 
-		for k, v := range sub {
-			fv, ok := fields[k]
-			if !ok {
-				continue
+	return fmt.Errorf("trealla: can't scan into type: %v; must be pointer to struct or map", rv.Type())
+}
+
+// scanStruct sets the fields of the struct rv from sub, collecting their errors in errs.
+// Fields are matched by the variable in their prolog tag, or their name.
+// Tags can be dotted paths like "Order.customer" to reach inside a variable's value (see [lookupPath]).
+// Struct fields that don't match a variable are scanned recursively for fields tagged with dotted paths;
+// other fields of nested structs are left alone.
+func scanStruct(sub Substitution, rv reflect.Value, prefix string, errs *[]FieldError) {
+	rtype := rv.Type()
+	for i := 0; i < rtype.NumField(); i++ {
+		f := rtype.Field(i)
+		fv := rv.Field(i)
+		if !fv.CanSet() {
+			continue
+		}
+		tag, skip := fieldTag(f)
+		if skip {
+			continue
+		}
+		path := f.Name
+		if tag != "" {
+			path = tag
+		}
+		name, rest, dotted := strings.Cut(path, ".")
+		v, ok := sub[name]
+		if prefix != "" && !dotted {
+			// only dotted paths reach into nested structs
+			ok = false
+		}
+		if !ok {
+			if f.Type.Kind() == reflect.Struct && f.Type != functorType && !dotted {
+				scanStruct(sub, fv, prefix+f.Name+".", errs)
 			}
-			if err := convert(fv, reflect.ValueOf(v), info[k]); err != nil {
-				return fmt.Errorf("trealla: error converting field %q in %v: %w", k, rv.Type(), err)
+			continue
+		}
+		if dotted {
+			var err error
+			if v, err = lookupPath(v, rest); err != nil {
+				*errs = append(*errs, FieldError{Field: prefix + f.Name, Path: path, Err: err})
+				continue
 			}
 		}
-		return nil
+		if err := convert(fv, reflect.ValueOf(v), f); err != nil {
+			*errs = append(*errs, FieldError{Field: prefix + f.Name, Path: path, Err: err})
+		}
 	}
+}
 
-	return fmt.Errorf("trealla: can't scan into type: %v; must be pointer to struct or map", rv.Type())
+// lookupPath follows a dotted path into t. Each step is one of:
+//   - a number N, selecting the Nth (1-based) argument of a compound or element of a list
+//   - a key of a list of Key=Value pairs or json(Pairs)
+//   - a functor F, selecting X from the argument F(X) of a compound
+func lookupPath(t Term, path string) (Term, error) {
+	for _, step := range strings.Split(path, ".") {
+		next, ok := lookupStep(t, step)
+		if !ok {
+			return nil, fmt.Errorf("no %q in %v", step, t)
+		}
+		t = next
+	}
+	return t, nil
+}
+
+func lookupStep(t Term, step string) (Term, bool) {
+	if n, err := strconv.Atoi(step); err == nil {
+		switch x := t.(type) {
+		case Compound:
+			if n >= 1 && n <= len(x.Args) {
+				return x.Args[n-1], true
+			}
+		case []Term:
+			if n >= 1 && n <= len(x) {
+				return x[n-1], true
+			}
+		}
+		return nil, false
+	}
+	if pairs, ok := termPairs(t); ok {
+		for _, pair := range pairs {
+			if pair.key == step {
+				return pair.value, true
+			}
+		}
+		return nil, false
+	}
+	if c, ok := t.(Compound); ok {
+		for _, arg := range c.Args {
+			if arg, ok := arg.(Compound); ok && arg.Functor == Atom(step) && len(arg.Args) == 1 {
+				return arg.Args[0], true
+			}
+		}
+	}
+	return nil, false
 }
 
 func convert(dstv, srcv reflect.Value, meta reflect.StructField) error {
@@ -92,10 +180,34 @@ func convert(dstv, srcv reflect.Value, meta reflect.StructField) error {
 		return nil
 	}
 
+	if ftype == anyType {
+		v := natural(srcv.Interface())
+		dstv.Set(reflect.ValueOf(&v).Elem())
+		return nil
+	}
+
 	if srcv.Kind() == reflect.Interface && !srcv.IsNil() {
 		srcv = srcv.Elem()
 	}
 
+	// Chars and Codes accept text in any representation
+	if ftype == charsType || ftype == codesType {
+		text, ok := Text(srcv.Interface())
+		if !ok {
+			return fmt.Errorf("can't convert from type %v to type: %v", srcv.Type(), ftype)
+		}
+		dstv.SetString(text)
+		return nil
+	}
+
+	// so does []rune, which would otherwise only take codes
+	if ftype == runesType {
+		if text, ok := Text(srcv.Interface()); ok {
+			dstv.Set(reflect.ValueOf([]rune(text)))
+			return nil
+		}
+	}
+
 	if dstv.Kind() == reflect.Slice {
 		length := srcv.Len()
 		srctype := srcv.Type()
@@ -111,8 +223,15 @@ func convert(dstv, srcv reflect.Value, meta reflect.StructField) error {
 			runes := []rune(srcv.String())
 			srcv = reflect.ValueOf(runes)
 			length = len(runes)
+			switch {
+			case srctype == codesType:
+				// if []Term, keep codes as int64
+				if termType.AssignableTo(detype) {
+					preconvert = true
+					etype = int64Type
+				}
 			// if []Atom or []Term
-			if dstv.Type().Elem().ConvertibleTo(atomType) || termType.AssignableTo(detype) {
+			case dstv.Type().Elem().ConvertibleTo(atomType) || termType.AssignableTo(detype):
 				preconvert = true
 				etype = atomType
 			}
@@ -137,6 +256,13 @@ func convert(dstv, srcv reflect.Value, meta reflect.StructField) error {
 		return nil
 	}
 
+	// Key=Value pairs → struct or map
+	if dstv.Kind() == reflect.Map || (dstv.Kind() == reflect.Struct && !hasFunctor(ftype)) {
+		if pairs, ok := termPairs(srcv.Interface()); ok {
+			return decodePairs(dstv, pairs)
+		}
+	}
+
 	// compound → struct
 	if srcv.Type() == compoundType && dstv.Kind() == reflect.Struct {
 		return decodeCompoundStruct(dstv, srcv.Interface().(Compound), meta)
@@ -149,6 +275,45 @@ func convert(dstv, srcv reflect.Value, meta reflect.StructField) error {
 	return nil
 }
 
+// Text returns the text held by t, which can be a string, an atom, [Chars], [Codes],
+// or a list of characters or codes. It reports false for other terms.
+func Text(t Term) (string, bool) {
+	switch x := t.(type) {
+	case string:
+		return x, true
+	case Chars:
+		return string(x), true
+	case Codes:
+		return string(x), true
+	case Atom:
+		if x == "[]" {
+			return "", true
+		}
+		return string(x), true
+	case []Term:
+		// either all characters or all codes
+		var sb strings.Builder
+		for _, elem := range x {
+			switch elem := elem.(type) {
+			case Atom:
+				if _, codes := x[0].(int64); codes || utf8.RuneCountInString(string(elem)) != 1 {
+					return "", false
+				}
+				sb.WriteString(string(elem))
+			case int64:
+				if _, chars := x[0].(Atom); chars || elem < 0 || elem > unicode.MaxRune {
+					return "", false
+				}
+				sb.WriteRune(rune(elem))
+			default:
+				return "", false
+			}
+		}
+		return sb.String(), true
+	}
+	return "", false
+}
+
 // TODO: break out reflect stuff into something like this:
 // type structInfo struct {
 // 	fields   []reflect.Value
@@ -170,8 +335,8 @@ func decodeCompoundStruct(dstv reflect.Value, src Compound, meta reflect.StructF
 		for i := 0; i < fieldnum; i++ {
 			field := rtype.Field(i)
 			fv := dstv.Field(i)
-			tag := field.Tag.Get("prolog")
-			if tag == "-" {
+			_, skip := fieldTag(field)
+			if skip {
 				continue
 			}
 			exported := field.IsExported()
@@ -241,8 +406,8 @@ func encodeCompoundStruct(src any) (Compound, error) {
 		for i := 0; i < fieldnum; i++ {
 			field := rtype.Field(i)
 			fv := dstv.Field(i)
-			tag := field.Tag.Get("prolog")
-			if tag == "-" {
+			tag, skip := fieldTag(field)
+			if skip {
 				continue
 			}
 			exported := field.IsExported()
@@ -294,11 +459,168 @@ func encodeCompoundStruct(src any) (Compound, error) {
 	return c, nil
 }
 
+type termPair struct {
+	key   string
+	value Term
+}
+
+// termPairs returns the pairs of a list of Key=Value or Key-Value terms, optionally wrapped in json/1.
+func termPairs(t Term) ([]termPair, bool) {
+	if c, ok := t.(Compound); ok && c.Functor == "json" && len(c.Args) == 1 {
+		t = c.Args[0]
+	}
+	if t == Atom("[]") {
+		return nil, true
+	}
+	list, ok := t.([]Term)
+	if !ok {
+		return nil, false
+	}
+	pairs := make([]termPair, 0, len(list))
+	for _, x := range list {
+		c, ok := x.(Compound)
+		if !ok || len(c.Args) != 2 || (c.Functor != "=" && c.Functor != "-") {
+			return nil, false
+		}
+		var key string
+		switch k := c.Args[0].(type) {
+		case Atom:
+			key = string(k)
+		case string:
+			key = k
+		default:
+			return nil, false
+		}
+		pairs = append(pairs, termPair{key: key, value: c.Args[1]})
+	}
+	return pairs, true
+}
+
+// Natural converts t to a plain Go value, the way [Substitution.Scan] fills fields of type any.
+// It returns an error if t is nil.
+func Natural(t Term) (any, error) {
+	if t == nil {
+		return nil, fmt.Errorf("trealla: can't convert nil term")
+	}
+	return natural(t), nil
+}
+
+// natural converts a term to a plain Go value, for Scan into fields of type any:
+//   - strings and numbers are unchanged
+//   - lists of Key=Value pairs and json(Pairs) become map[string]any, unless a key repeats
+//   - other lists become []any, so pairs with repeated keys are kept as they are
+//   - unbound variables become nil
+//   - atoms and other compounds are unchanged
+func natural(t Term) any {
+	switch x := t.(type) {
+	case Atom:
+		if x == "[]" {
+			return []any{}
+		}
+	case Variable:
+		return nil
+	case []Term:
+		if len(x) > 0 {
+			if pairs, ok := termPairs(x); ok {
+				if m, ok := naturalMap(pairs); ok {
+					return m
+				}
+			}
+		}
+		list := make([]any, len(x))
+		for i, elem := range x {
+			list[i] = natural(elem)
+		}
+		return list
+	case Compound:
+		if pairs, ok := termPairs(x); ok {
+			if m, ok := naturalMap(pairs); ok {
+				return m
+			}
+		}
+	}
+	return t
+}
+
+// naturalMap converts pairs to a map, reporting false if a key repeats.
+func naturalMap(pairs []termPair) (map[string]any, bool) {
+	m := make(map[string]any, len(pairs))
+	for _, pair := range pairs {
+		if _, dupe := m[pair.key]; dupe {
+			return nil, false
+		}
+		m[pair.key] = natural(pair.value)
+	}
+	return m, true
+}
+
+func hasFunctor(rtype reflect.Type) bool {
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+		if field.Type == functorType {
+			return true
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && hasFunctor(field.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodePairs sets the fields of a struct or the entries of a map.
+// Struct fields are matched by name like Scan, falling back to a case-insensitive match.
+func decodePairs(dstv reflect.Value, pairs []termPair) error {
+	if dstv.Kind() == reflect.Map {
+		mtype := dstv.Type()
+		if mtype.Key().Kind() != reflect.String {
+			return fmt.Errorf("can't convert pairs to map with key type %v", mtype.Key())
+		}
+		m := reflect.MakeMapWithSize(mtype, len(pairs))
+		for _, pair := range pairs {
+			ev := reflect.New(mtype.Elem()).Elem()
+			if err := convert(ev, reflect.ValueOf(&pair.value).Elem(), reflect.StructField{}); err != nil {
+				return fmt.Errorf("can't convert map value for key %q: %w", pair.key, err)
+			}
+			m.SetMapIndex(reflect.ValueOf(pair.key).Convert(mtype.Key()), ev)
+		}
+		dstv.Set(m)
+		return nil
+	}
+
+	fields := plainFields(dstv)
+	for _, pair := range pairs {
+		i := slices.IndexFunc(fields, func(f plainField) bool { return f.name == pair.key })
+		if i == -1 {
+			i = slices.IndexFunc(fields, func(f plainField) bool { return strings.EqualFold(f.name, pair.key) })
+		}
+		if i == -1 {
+			continue
+		}
+		field := fields[i]
+		if err := convert(field.value, reflect.ValueOf(&pair.value).Elem(), field.info); err != nil {
+			return fmt.Errorf("can't convert %q into field %q: %w", pair.key, field.info.Name, err)
+		}
+	}
+	return nil
+}
+
+// fieldTag parses the prolog tag of a field, returning its name (without options after a comma)
+// and whether the field is skipped with "-".
+func fieldTag(field reflect.StructField) (name string, skip bool) {
+	tag := field.Tag.Get("prolog")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ = strings.Cut(tag, ",")
+	return name, false
+}
+
+// structTag splits the name of a Functor field's tag, such as "foo/2", into a functor and arity.
 func structTag(tag string) (name string, arity int) {
 	if tag == "" {
 		return
 	}
-	name, _, _ = strings.Cut(tag, ",")
+	name = tag
 	slash := strings.LastIndexByte(name, '/')
 	if slash > 0 && slash < len(name)-1 {
 		arity, _ = strconv.Atoi(name[slash+1:])
@@ -0,0 +1,258 @@
+package trealla
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// KBDiff describes how a knowledgebase differs from another. See [Diff].
+type KBDiff struct {
+	// Predicates whose clauses changed, sorted by module and predicate indicator.
+	Predicates []PredicateDiff
+	// Flags that changed, sorted by name.
+	Flags []FlagDiff
+	// Ops are operators that changed, sorted by name and type.
+	Ops []OpDiff
+}
+
+// PredicateDiff lists the clauses added to and removed from a predicate.
+// Clauses are in the format of [Prolog.Dump]. Changes to clause order are not reported.
+type PredicateDiff struct {
+	Module Atom
+	// Predicate is the predicate indicator, such as "foo/2".
+	Predicate string
+	Added     []string
+	Removed   []string
+}
+
+// FlagDiff is a Prolog flag that changed.
+// Old or New is nil if the flag didn't exist.
+type FlagDiff struct {
+	Name Atom
+	Old  Term
+	New  Term
+}
+
+// OpDiff is an operator that changed.
+// A priority of 0 means the operator wasn't defined.
+type OpDiff struct {
+	Name Atom
+	// Type is the operator specifier, such as xfx.
+	Type Atom
+	Old  int64
+	New  int64
+}
+
+// Empty reports whether there are no differences.
+func (d KBDiff) Empty() bool {
+	return len(d.Predicates) == 0 && len(d.Flags) == 0 && len(d.Ops) == 0
+}
+
+// String returns a human-readable summary of the differences,
+// with added clauses prefixed by + and removed clauses prefixed by -.
+func (d KBDiff) String() string {
+	var sb strings.Builder
+	for _, pred := range d.Predicates {
+		fmt.Fprintf(&sb, "%s:%s\n", pred.Module.String(), pred.Predicate)
+		for _, clause := range pred.Removed {
+			sb.WriteString("- " + clause + "\n")
+		}
+		for _, clause := range pred.Added {
+			sb.WriteString("+ " + clause + "\n")
+		}
+	}
+	for _, flag := range d.Flags {
+		fmt.Fprintf(&sb, "flag %s: %s -> %s\n", flag.Name.String(), diffTermString(flag.Old), diffTermString(flag.New))
+	}
+	for _, op := range d.Ops {
+		fmt.Fprintf(&sb, "op %s %s: %d -> %d\n", op.Name.String(), op.Type, op.Old, op.New)
+	}
+	return sb.String()
+}
+
+func diffTermString(t Term) string {
+	if t == nil {
+		return "none"
+	}
+	text, err := marshal(t)
+	if err != nil {
+		return fmt.Sprint(t)
+	}
+	return text
+}
+
+// Diff compares the knowledgebases of two interpreters, returning the changes that would turn a into b.
+// Native predicates are compared by name only.
+// a and b may be used within a native predicate, or be the same interpreter.
+func Diff(ctx context.Context, a, b Prolog) (KBDiff, error) {
+	before, err := snapshotOf(ctx, a)
+	if err != nil {
+		return KBDiff{}, err
+	}
+	after, err := snapshotOf(ctx, b)
+	if err != nil {
+		return KBDiff{}, err
+	}
+	return before.diff(after), nil
+}
+
+// kbSnapshot is the part of a knowledgebase compared by Diff.
+type kbSnapshot struct {
+	preds map[predicateKey][]string
+	ops   map[string]Term
+	flags map[Atom]Term
+}
+
+type predicateKey struct {
+	module Atom
+	pi     string
+}
+
+func snapshotOf(ctx context.Context, p Prolog) (kbSnapshot, error) {
+	switch p := p.(type) {
+	case *prolog:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.instance == nil {
+			return kbSnapshot{}, io.EOF
+		}
+		return p.snapshot(ctx)
+	case *lockedProlog:
+		if err := p.ensure(); err != nil {
+			return kbSnapshot{}, err
+		}
+		return p.prolog.snapshot(ctx)
+	}
+	return kbSnapshot{}, fmt.Errorf("trealla: can't diff %T", p)
+}
+
+func (pl *prolog) snapshot(ctx context.Context) (kbSnapshot, error) {
+	snap := kbSnapshot{
+		preds: make(map[predicateKey][]string),
+	}
+	src, err := pl.source(ctx, sourceOptions{natives: true})
+	if err != nil {
+		return snap, err
+	}
+	for _, ms := range src.modules {
+		for _, pred := range ms.preds {
+			snap.preds[predicateKey{module: ms.name, pi: pred.pi}] = pred.clauses
+		}
+	}
+	if snap.ops, err = pl.currentOps(ctx); err != nil {
+		return snap, err
+	}
+	if snap.flags, err = pl.currentFlags(ctx); err != nil {
+		return snap, err
+	}
+	for name := range readOnlyFlags {
+		delete(snap.flags, name)
+	}
+	return snap, nil
+}
+
+func (before kbSnapshot) diff(after kbSnapshot) KBDiff {
+	var d KBDiff
+
+	keys := make(map[predicateKey]struct{}, len(after.preds))
+	for key := range before.preds {
+		keys[key] = struct{}{}
+	}
+	for key := range after.preds {
+		keys[key] = struct{}{}
+	}
+	for key := range keys {
+		added, removed := diffClauses(before.preds[key], after.preds[key])
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+		d.Predicates = append(d.Predicates, PredicateDiff{
+			Module:    key.module,
+			Predicate: key.pi,
+			Added:     added,
+			Removed:   removed,
+		})
+	}
+	slices.SortFunc(d.Predicates, func(a, b PredicateDiff) int {
+		return cmp.Or(cmp.Compare(a.Module, b.Module), cmp.Compare(a.Predicate, b.Predicate))
+	})
+
+	for name, old := range before.flags {
+		if v, ok := after.flags[name]; !ok || !reflect.DeepEqual(old, v) {
+			d.Flags = append(d.Flags, FlagDiff{Name: name, Old: old, New: v})
+		}
+	}
+	for name, v := range after.flags {
+		if _, ok := before.flags[name]; !ok {
+			d.Flags = append(d.Flags, FlagDiff{Name: name, New: v})
+		}
+	}
+	slices.SortFunc(d.Flags, func(a, b FlagDiff) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	for key, op := range before.ops {
+		var prio int64
+		if v, ok := after.ops[key]; ok {
+			prio = opPriority(v)
+		}
+		if old := opPriority(op); old != prio {
+			d.Ops = append(d.Ops, newOpDiff(op, old, prio))
+		}
+	}
+	for key, op := range after.ops {
+		if _, ok := before.ops[key]; !ok {
+			d.Ops = append(d.Ops, newOpDiff(op, 0, opPriority(op)))
+		}
+	}
+	slices.SortFunc(d.Ops, func(a, b OpDiff) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Type, b.Type))
+	})
+
+	return d
+}
+
+// diffClauses returns the clauses of after that aren't in before, and vice versa.
+// Duplicate clauses are counted.
+func diffClauses(before, after []string) (added, removed []string) {
+	count := make(map[string]int, len(before))
+	for _, clause := range before {
+		count[clause]++
+	}
+	for _, clause := range after {
+		if count[clause] > 0 {
+			count[clause]--
+			continue
+		}
+		added = append(added, clause)
+	}
+	for _, clause := range before {
+		if count[clause] > 0 {
+			count[clause]--
+			removed = append(removed, clause)
+		}
+	}
+	return
+}
+
+// opPriority returns the priority of an op(P, T, N) term.
+func opPriority(op Term) int64 {
+	c, ok := op.(Compound)
+	if !ok || len(c.Args) != 3 {
+		return 0
+	}
+	prio, _ := c.Args[0].(int64)
+	return prio
+}
+
+func newOpDiff(op Term, old, new int64) OpDiff {
+	c := op.(Compound)
+	name, _ := c.Args[2].(Atom)
+	typ, _ := c.Args[1].(Atom)
+	return OpDiff{Name: name, Type: typ, Old: old, New: new}
+}
@@ -0,0 +1,103 @@
+package trealla
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+	a, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ConsultText(ctx, "user", `
+		:- dynamic(n/1).
+		n(1). n(2).
+		rule(X) :- n(X).
+	`); err != nil {
+		t.Fatal(err)
+	}
+	b, err := a.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.QueryOnce(ctx, `retract(n(1)), assertz(m(1)), op(700, xfx, ===>), set_prolog_flag(double_quotes, atom).`); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := Diff(ctx, a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := KBDiff{
+		Predicates: []PredicateDiff{
+			{Module: "user", Predicate: "m/1", Added: []string{"m(1)."}},
+			{Module: "user", Predicate: "n/1", Removed: []string{"n(1)."}},
+		},
+		Flags: []FlagDiff{
+			{Name: "double_quotes", Old: Atom("chars"), New: Atom("atom")},
+		},
+		Ops: []OpDiff{
+			{Name: "===>", Type: "xfx", Old: 0, New: 700},
+		},
+	}
+	if !reflect.DeepEqual(want, diff) {
+		t.Errorf("want:\n%s\ngot:\n%s", want, diff)
+	}
+
+	same, err := Diff(ctx, a, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same.Empty() {
+		t.Error("expected no differences, got:", same)
+	}
+}
+
+func TestWriteTxDiff(t *testing.T) {
+	ctx := context.Background()
+	pool, err := NewPool(WithPoolSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert := func(pl Prolog) error {
+		_, err := pl.QueryOnce(ctx, `assertz(deployed(v2)).`)
+		return err
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		var diff KBDiff
+		if err := pool.WriteTx(assert, WithTxDiff(&diff), WithTxDryRun()); err != nil {
+			t.Fatal(err)
+		}
+		want := []PredicateDiff{{Module: "user", Predicate: "deployed/1", Added: []string{"deployed(v2)."}}}
+		if !reflect.DeepEqual(want, diff.Predicates) {
+			t.Error("want:", want, "got:", diff.Predicates)
+		}
+		err := pool.ReadTx(func(pl Prolog) error {
+			_, err := pl.QueryOnce(ctx, `deployed(_).`)
+			return err
+		})
+		if err == nil {
+			t.Error("dry run changed the knowledgebase")
+		}
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		var diff KBDiff
+		if err := pool.WriteTx(assert, WithTxDiff(&diff)); err != nil {
+			t.Fatal(err)
+		}
+		if len(diff.Predicates) != 1 {
+			t.Error("unexpected diff:", diff)
+		}
+		if err := pool.ReadTx(func(pl Prolog) error {
+			_, err := pl.QueryOnce(ctx, `deployed(v2).`)
+			return err
+		}); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package trealla
+
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
+// DumpOption is an optional parameter for [Prolog.Dump].
+type DumpOption func(*sourceOptions)
+
+// WithDumpModules limits a dump to the given modules.
+// By default all modules are dumped, except for Trealla's own libraries.
+func WithDumpModules(modules ...Atom) DumpOption {
+	return func(opts *sourceOptions) {
+		opts.modules = append(opts.modules, modules...)
+	}
+}
+
+func (pl *prolog) Dump(ctx context.Context, w io.Writer, options ...DumpOption) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.instance == nil {
+		return io.EOF
+	}
+	return pl.dump(ctx, w, options)
+}
+
+func (pl *prolog) dump(ctx context.Context, w io.Writer, options []DumpOption) error {
+	var opts sourceOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	src, err := pl.source(ctx, opts)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	src.write(bw)
+	return bw.Flush()
+}
+
+// write writes the knowledgebase as a consultable file.
+// Operators come first so the clauses can be read,
+// and flags last so they don't change how the clauses are read.
+func (src kbSource) write(w *bufio.Writer) {
+	if len(src.ops) > 0 {
+		w.WriteString("% operators\n")
+		for _, op := range src.ops {
+			w.WriteString(":- " + op.(Compound).String() + ".\n")
+		}
+		w.WriteByte('\n')
+	}
+	for _, ms := range src.modules {
+		w.WriteString("% module " + string(ms.name) + "\n")
+		w.WriteString(ms.String())
+		w.WriteByte('\n')
+	}
+	if len(src.flags) > 0 {
+		w.WriteString("% flags\n")
+		for _, flag := range src.flags {
+			w.WriteString(":- " + flag.(Compound).String() + ".\n")
+		}
+	}
+}
+
+func (pl *lockedProlog) Dump(ctx context.Context, w io.Writer, options ...DumpOption) error {
+	if err := pl.ensure(); err != nil {
+		return err
+	}
+	return pl.prolog.dump(ctx, w, options)
+}
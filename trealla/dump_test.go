@@ -0,0 +1,86 @@
+package trealla
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := pl.Register(ctx, "twice", 2, func(_ Prolog, _ Subquery, goal Term) Term {
+		return goal
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.ConsultText(ctx, "user", `
+		greet(Name, Msg) :- atom_concat('hello ', Name, Msg).
+		s("str").
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.ConsultText(ctx, "user", `
+		:- module(mymod, [hello/1]).
+		hello(X) :- helper(X).
+		helper(world).
+	`); err != nil {
+		t.Fatal(err)
+	}
+	for _, goal := range []string{
+		`op(700, xfx, ===>).`,
+		`assertz((a ===> b)), assertz(fact(1)), set_prolog_flag(double_quotes, codes).`,
+	} {
+		if _, err := pl.QueryOnce(ctx, goal); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var sb strings.Builder
+	if err := pl.Dump(ctx, &sb); err != nil {
+		t.Fatal(err)
+	}
+	dump := sb.String()
+	for _, want := range []string{
+		":- op(700, xfx, '===>').",
+		":- dynamic(fact/1).",
+		"fact(1).",
+		"greet(A,B):-atom_concat('hello ',A,B).",
+		":- module(mymod, [hello/1]).",
+		":- set_prolog_flag(double_quotes, codes).",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("missing %q", want)
+		}
+	}
+	if strings.Contains(dump, "twice") {
+		t.Error("native predicate was dumped")
+	}
+
+	t.Run("modules", func(t *testing.T) {
+		var sb strings.Builder
+		if err := pl.Dump(ctx, &sb, WithDumpModules("mymod")); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(sb.String(), "greet") || !strings.Contains(sb.String(), "helper(world).") {
+			t.Error("unexpected dump:", sb.String())
+		}
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		fresh, err := New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fresh.ConsultText(ctx, "user", dump); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fresh.QueryOnce(ctx, `fact(1), '===>'(a, b), greet(x, 'hello x'), s("str"), mymod:hello(world).`); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -1,128 +1,504 @@
 package trealla
 
 import (
+	"bytes"
+	"encoding"
+	"errors"
 	"fmt"
 	"math/big"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
+// DefaultMaxDepth is the default limit on how deeply terms may be nested,
+// for [Marshal] (see [WithMarshalMaxDepth]) and answers decoded by an interpreter (see [WithMaxDepth]).
+// Answers are JSON, where each level of a term takes up to two levels of nesting,
+// so this is kept well below the 10000 levels that encoding/json accepts.
+const DefaultMaxDepth = 4000
+
+var (
+	// ErrCycle is returned when marshaling a Go value that refers to itself.
+	ErrCycle = errors.New("trealla: can't marshal cyclic value")
+	// ErrTooDeep is returned when a term is nested deeper than the maximum depth.
+	ErrTooDeep = errors.New("trealla: term nested too deeply")
+	// ErrTooLarge is returned when a marshaled term would exceed the maximum size.
+	ErrTooLarge = errors.New("trealla: marshaled term too large")
+)
+
+// MarshalOption is an option for [Marshal].
+type MarshalOption func(*encoder)
+
+// StructEncoding is how structs without a [Functor] field are marshaled.
+type StructEncoding int
+
+const (
+	// StructPairs marshals structs as a list of Field=Value pairs, like maps.
+	// This is the default.
+	StructPairs StructEncoding = iota
+	// StructCompound marshals structs as a compound named after the type in snake_case,
+	// with the fields as arguments in order, like structs that embed [Functor].
+	StructCompound
+)
+
+// WithMarshalStructs sets how structs without a [Functor] field are marshaled.
+func WithMarshalStructs(enc StructEncoding) MarshalOption {
+	return func(e *encoder) {
+		e.structs = enc
+	}
+}
+
+// WithMarshalMaxDepth limits how deeply terms may be nested. The default is [DefaultMaxDepth]; 0 disables the limit.
+func WithMarshalMaxDepth(depth int) MarshalOption {
+	return func(e *encoder) {
+		e.maxDepth = depth
+	}
+}
+
+// WithMarshalMaxSize limits the length of the marshaled text, in bytes. By default it is unlimited.
+func WithMarshalMaxSize(size int) MarshalOption {
+	return func(e *encoder) {
+		e.maxSize = size
+	}
+}
+
 // Marshal returns the Prolog text representation of term.
-func Marshal(term Term) (string, error) {
-	return marshal(term)
+// Returns [ErrCycle], [ErrTooDeep] or [ErrTooLarge] (wrapped) if term can't be marshaled within the limits.
+func Marshal(term Term, options ...MarshalOption) (string, error) {
+	return marshalWith(term, nil, options)
+}
+
+// marshalWith is Marshal with an operator table, or nil to write compounds canonically.
+func marshalWith(term Term, ops *opTable, options []MarshalOption) (string, error) {
+	e := newEncoder(options)
+	e.ops = ops
+	if err := e.encode(term, 1200); err != nil {
+		return "", err
+	}
+	return e.String(), nil
 }
 
+// marshal is Marshal for our own use, such as replies to host calls and bindings.
+// Only cycles are checked for, as depth and size are bounded by the interpreter.
 func marshal(term Term) (string, error) {
+	return marshalOps(term, nil)
+}
+
+// marshalOps is marshal with an operator table, for text read by the interpreter it belongs to.
+func marshalOps(term Term, ops *opTable) (string, error) {
+	e := newEncoder(nil)
+	e.maxDepth = 0
+	e.ops = ops
+	if err := e.encode(term, 1200); err != nil {
+		return "", err
+	}
+	return e.String(), nil
+}
+
+// encoder writes terms as Prolog text.
+type encoder struct {
+	bytes.Buffer
+	// ops is the operator table, or nil to write terms canonically
+	ops      *opTable
+	structs  StructEncoding
+	maxDepth int
+	maxSize  int
+	depth    int
+	// slices and pointers being encoded, for finding cycles
+	path map[visit]struct{}
+	// lenient writes invalid arguments as <invalid: ...> instead of failing
+	lenient bool
+}
+
+type visit struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+// cycles can only happen once we're this deep; checking for them is skipped until then
+const cycleDepth = 100
+
+func newEncoder(options []MarshalOption) *encoder {
+	e := &encoder{maxDepth: DefaultMaxDepth}
+	for _, opt := range options {
+		opt(e)
+	}
+	return e
+}
+
+func (e *encoder) encode(term Term, prec int) error {
+	e.depth++
+	defer func() { e.depth-- }()
+	if e.maxDepth > 0 && e.depth > e.maxDepth {
+		return fmt.Errorf("%w (max depth: %d)", ErrTooDeep, e.maxDepth)
+	}
+	if e.depth > cycleDepth {
+		if key, ok := visitOf(term); ok {
+			if _, seen := e.path[key]; seen {
+				return fmt.Errorf("%w of type %T", ErrCycle, term)
+			}
+			if e.path == nil {
+				e.path = make(map[visit]struct{})
+			}
+			e.path[key] = struct{}{}
+			defer delete(e.path, key)
+		}
+	}
+
+	if err := e.write(term, prec); err != nil {
+		return err
+	}
+	if e.maxSize > 0 && e.Len() > e.maxSize {
+		return fmt.Errorf("%w (max size: %d bytes)", ErrTooLarge, e.maxSize)
+	}
+	return nil
+}
+
+// visitOf identifies the reference held by term, if any.
+func visitOf(term Term) (visit, bool) {
+	var rv reflect.Value
+	if c, ok := term.(Compound); ok {
+		rv = reflect.ValueOf(c.Args)
+	} else {
+		rv = reflect.ValueOf(term)
+	}
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Map:
+		if rv.IsNil() {
+			return visit{}, false
+		}
+		return visit{ptr: rv.Pointer(), typ: rv.Type()}, true
+	case reflect.Slice:
+		if rv.IsNil() {
+			return visit{}, false
+		}
+		return visit{ptr: rv.Pointer(), len: rv.Len(), typ: rv.Type()}, true
+	}
+	return visit{}, false
+}
+
+func (e *encoder) write(term Term, prec int) error {
 	switch x := term.(type) {
 	case string:
-		return escapeString(x), nil
+		e.WriteString(escapeString(x))
 	case int64:
-		return strconv.FormatInt(x, 10), nil
+		e.WriteString(strconv.FormatInt(x, 10))
 	case int:
-		return strconv.FormatInt(int64(x), 10), nil
+		e.WriteString(strconv.FormatInt(int64(x), 10))
 	case uint64:
-		return strconv.FormatUint(x, 10), nil
+		e.WriteString(strconv.FormatUint(x, 10))
 	case uint:
-		return strconv.FormatUint(uint64(x), 10), nil
+		e.WriteString(strconv.FormatUint(uint64(x), 10))
 	case float64:
-		return strconv.FormatFloat(x, 'f', -1, 64), nil
+		e.WriteString(strconv.FormatFloat(x, 'f', -1, 64))
 	case float32:
-		return strconv.FormatFloat(float64(x), 'f', -1, 32), nil
+		e.WriteString(strconv.FormatFloat(float64(x), 'f', -1, 32))
 	case *big.Int:
-		return x.String(), nil
+		e.WriteString(x.String())
 	case Atom:
-		return x.String(), nil
+		e.atom(x, prec)
+	case Chars:
+		chars := make([]Term, 0, len(x))
+		for _, r := range x {
+			chars = append(chars, Atom(string(r)))
+		}
+		return encodeSlice(e, chars)
+	case Codes:
+		codes := make([]Term, 0, len(x))
+		for _, r := range x {
+			codes = append(codes, int64(r))
+		}
+		return encodeSlice(e, codes)
 	case Compound:
-		return x.String(), nil
+		return e.compound(x, prec)
 	case Variable:
-		return x.String(), nil
+		return e.variable(x)
 	case compoundStruct:
 		c, err := encodeCompoundStruct(term)
 		if err != nil {
-			return "", fmt.Errorf("trealla: error marshaling term %#v: %w", term, err)
+			return fmt.Errorf("trealla: error marshaling term %#v: %w", term, err)
 		}
-		return c.String(), nil
+		return e.compound(c, prec)
 	case []Term:
-		return marshalSlice(x)
+		return encodeSlice(e, x)
 	case []any:
-		return marshalSlice(x)
+		return encodeSlice(e, x)
 	case []string:
-		return marshalSlice(x)
+		return encodeSlice(e, x)
 	case []int64:
-		return marshalSlice(x)
+		return encodeSlice(e, x)
 	case []int:
-		return marshalSlice(x)
+		return encodeSlice(e, x)
 	case []float64:
-		return marshalSlice(x)
+		return encodeSlice(e, x)
 	case []*big.Int:
-		return marshalSlice(x)
+		return encodeSlice(e, x)
 	case []Atom:
-		return marshalSlice(x)
+		return encodeSlice(e, x)
 	case []Compound:
-		return marshalSlice(x)
+		return encodeSlice(e, x)
 	case []Variable:
-		return marshalSlice(x)
+		return encodeSlice(e, x)
 	default:
-		rv := reflect.ValueOf(term)
-		if !rv.IsValid() {
-			break
-		}
-		for rv.Kind() == reflect.Pointer && !rv.IsNil() {
-			rv = rv.Elem()
-		}
-		if !rv.CanInterface() {
-			break
-		}
-
-		switch rv.Kind() {
-		case reflect.Slice, reflect.Array:
-			var sb strings.Builder
-			sb.WriteByte('[')
-			length := rv.Len()
-			for i := 0; i < length; i++ {
-				if i != 0 {
-					sb.WriteByte(',')
-				}
-				elem, err := marshal(rv.Index(i).Interface())
-				if err != nil {
-					return "", err
-				}
-				sb.WriteString(elem)
+		return e.reflect(term)
+	}
+	return nil
+}
+
+func (e *encoder) reflect(term Term) error {
+	rv := reflect.ValueOf(term)
+	if !rv.IsValid() {
+		return fmt.Errorf("trealla: can't marshal type %T, value: %v", term, term)
+	}
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if !rv.CanInterface() {
+		return fmt.Errorf("trealla: can't marshal type %T, value: %v", term, term)
+	}
+
+	// values implementing encoding.TextMarshaler are written as strings, whatever their kind
+	if text, ok := marshalText(rv); ok {
+		str, err := text.MarshalText()
+		if err != nil {
+			return fmt.Errorf("trealla: error marshaling %v: %w", rv.Type(), err)
+		}
+		e.WriteString(escapeString(string(str)))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		e.WriteByte('[')
+		length := rv.Len()
+		for i := 0; i < length; i++ {
+			if i != 0 {
+				e.WriteByte(',')
+			}
+			if err := e.encode(rv.Index(i).Interface(), 999); err != nil {
+				return err
 			}
-			sb.WriteByte(']')
-			return sb.String(), nil
+		}
+		e.WriteByte(']')
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+		e.WriteString(strconv.FormatInt(rv.Int(), 10))
+	case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		e.WriteString(strconv.FormatUint(rv.Uint(), 10))
+	case reflect.Float64:
+		e.WriteString(strconv.FormatFloat(rv.Float(), 'f', -1, 64))
+	case reflect.Float32:
+		e.WriteString(strconv.FormatFloat(rv.Float(), 'f', -1, 32))
+	case reflect.String:
+		e.WriteString(escapeString(rv.String()))
+	case reflect.Struct:
+		return e.structure(rv)
+	case reflect.Map:
+		return e.pairs(rv)
+	default:
+		return fmt.Errorf("trealla: can't marshal type %T, value: %v", term, term)
+	}
+	return nil
+}
+
+// structure writes a struct without a Functor field.
+func (e *encoder) structure(rv reflect.Value) error {
+	fields := plainFields(rv)
+	if len(fields) == 0 && rv.NumField() > 0 {
+		// don't silently drop its data
+		return fmt.Errorf("trealla: can't marshal type %v: no exported fields", rv.Type())
+	}
+	name := rv.Type().Name()
+	if e.structs == StructCompound && name != "" {
+		c := Compound{Functor: Atom(snakeCase(name)), Args: make([]Term, len(fields))}
+		for i, field := range fields {
+			c.Args[i] = field.value.Interface()
+		}
+		return e.compound(c, 999)
+	}
+
+	pairs := make([]Term, len(fields))
+	for i, field := range fields {
+		pairs[i] = Atom("=").Of(Atom(field.name), field.value.Interface())
+	}
+	return encodeSlice(e, pairs)
+}
+
+func marshalText(rv reflect.Value) (encoding.TextMarshaler, bool) {
+	if text, ok := rv.Interface().(encoding.TextMarshaler); ok {
+		return text, true
+	}
+	if rv.CanAddr() {
+		text, ok := rv.Addr().Interface().(encoding.TextMarshaler)
+		return text, ok
+	}
+	return nil, false
+}
+
+// pairs writes a map with string keys as a list of Key=Value pairs, sorted by key.
+func (e *encoder) pairs(rv reflect.Value) error {
+	if rv.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("trealla: can't marshal map with key type %v", rv.Type().Key())
+	}
+	keys := rv.MapKeys()
+	slices.SortFunc(keys, func(a, b reflect.Value) int {
+		return strings.Compare(a.String(), b.String())
+	})
+	pairs := make([]Term, len(keys))
+	for i, k := range keys {
+		pairs[i] = Atom("=").Of(Atom(k.String()), rv.MapIndex(k).Interface())
+	}
+	return encodeSlice(e, pairs)
+}
+
+// plainField is a field of a struct without a Functor field.
+type plainField struct {
+	// name is the prolog tag's name or the field's name
+	name  string
+	value reflect.Value
+	info  reflect.StructField
+}
 
-		case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
-			return strconv.FormatInt(rv.Int(), 10), nil
-		case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
-			return strconv.FormatUint(rv.Uint(), 10), nil
-		case reflect.Float64:
-			return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
-		case reflect.Float32:
-			return strconv.FormatFloat(rv.Float(), 'f', -1, 32), nil
-		case reflect.String:
-			return escapeString(rv.String()), nil
+// plainFields returns the exported fields of a struct, including those of embedded structs.
+func plainFields(rv reflect.Value) []plainField {
+	rtype := rv.Type()
+	fields := make([]plainField, 0, rtype.NumField())
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+		name, skip := fieldTag(field)
+		if skip {
+			continue
 		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fields = append(fields, plainFields(rv.Field(i))...)
+			continue
+		}
+		if !field.IsExported() || !rv.Field(i).CanInterface() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, plainField{name: name, value: rv.Field(i), info: field})
 	}
-	return "", fmt.Errorf("trealla: can't marshal type %T, value: %v", term, term)
+	return fields
 }
 
-func marshalSlice[T any](slice []T) (string, error) {
+// snakeCase converts a Go name like APIRequest to api_request.
+func snakeCase(name string) string {
+	runes := []rune(name)
 	var sb strings.Builder
-	sb.WriteRune('[')
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// start a new word at a lowercase→uppercase boundary, or at the last capital of an acronym
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func encodeSlice[T any](e *encoder, slice []T) error {
+	e.WriteByte('[')
 	for i, v := range slice {
 		if i != 0 {
-			sb.WriteString(", ")
+			e.WriteString(", ")
 		}
-		text, err := marshal(v)
-		if err != nil {
-			return "", err
+		if err := e.encode(v, 999); err != nil {
+			return err
+		}
+	}
+	e.WriteByte(']')
+	return nil
+}
+
+// arg writes an argument of a compound, or a placeholder for it if it's invalid and e is lenient.
+func (e *encoder) arg(term Term, prec int) error {
+	mark := e.Len()
+	err := e.encode(term, prec)
+	if err != nil && e.lenient {
+		e.Truncate(mark)
+		e.WriteString(fmt.Sprintf("<invalid: %v>", err))
+		return nil
+	}
+	return err
+}
+
+func (e *encoder) atom(a Atom, prec int) {
+	if e.ops == nil {
+		e.WriteString(a.String())
+		return
+	}
+	if p, ok := e.ops.atoms[a]; ok && p > prec {
+		e.WriteString("(" + atomText(a) + ")")
+		return
+	}
+	e.WriteString(atomText(a))
+}
+
+func (e *encoder) compound(c Compound, prec int) error {
+	if len(c.Args) == 0 {
+		e.atom(c.Functor, prec)
+		return nil
+	}
+	if e.ops != nil {
+		if op, ok := e.ops.find(c); ok {
+			return e.operation(c, op, prec)
+		}
+		if c.Functor == "{}" && len(c.Args) == 1 {
+			e.WriteByte('{')
+			if err := e.arg(c.Args[0], 1200); err != nil {
+				return err
+			}
+			e.WriteByte('}')
+			return nil
+		}
+	} else if len(c.Args) == 2 && (c.Functor == "/" || c.Functor == ":") {
+		// special case these two operators for now?
+		if err := e.arg(c.Args[0], 999); err != nil {
+			return err
+		}
+		e.WriteString(string(c.Functor))
+		return e.arg(c.Args[1], 999)
+	}
+
+	if e.ops != nil {
+		e.WriteString(atomText(c.Functor))
+	} else {
+		e.WriteString(c.Functor.String())
+	}
+	e.WriteByte('(')
+	for i, arg := range c.Args {
+		if i > 0 {
+			e.WriteString(", ")
+		}
+		if err := e.arg(arg, 999); err != nil {
+			return err
+		}
+	}
+	e.WriteByte(')')
+	return nil
+}
+
+func (e *encoder) variable(v Variable) error {
+	if len(v.Attr) == 0 {
+		e.WriteString(v.Name)
+		return nil
+	}
+	for i, attr := range v.Attr {
+		if i != 0 {
+			e.WriteString(", ")
+		}
+		if err := e.encode(attr, 999); err != nil {
+			return err
 		}
-		sb.WriteString(text)
 	}
-	sb.WriteRune(']')
-	return sb.String(), nil
+	return nil
 }
 
 func escapeString(str string) string {
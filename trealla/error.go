@@ -3,6 +3,9 @@ package trealla
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
 )
 
 // ErrFailure is returned when a query fails (when it finds no solutions).
@@ -35,6 +38,9 @@ type ErrThrow struct {
 	Stdout string
 	// Stderr output from the query (useful for traces).
 	Stderr string
+
+	// Go error that Ball was made from, if it was thrown by a native predicate.
+	cause error
 }
 
 // Error implements the error interface.
@@ -42,6 +48,173 @@ func (err ErrThrow) Error() string {
 	return fmt.Sprintf("trealla: exception thrown: %v", err.Ball)
 }
 
+// Unwrap returns the original Go error when the exception was thrown by a native predicate
+// that returned an error term containing it (or panicked with it), and nil otherwise.
+// Prolog code sees such errors as go_error(Message, ID) terms within the ball.
+func (err ErrThrow) Unwrap() error {
+	return err.cause
+}
+
+// goErrors numbers the Go errors behind exceptions, so each thrown ball can be told apart.
+var goErrors atomic.Int64
+
+// capture records the Go errors of exceptions thrown by native predicates,
+// replacing each with go_error(Message, ID) so that Prolog sees a regular term.
+// The ID is unique, so a ball thrown by Prolog code never picks up the cause of another.
+func (q *query) capture(result Term) Term {
+	ex, ok := result.(Compound)
+	if !ok || ex.Functor != "throw" || len(ex.Args) != 1 {
+		return result
+	}
+	ball, changed := scrubErrors(ex.Args[0], q.remember)
+	if !changed {
+		return result
+	}
+	return throwTerm(ball)
+}
+
+// remember associates the go_error/2 token id with the Go error it came from.
+// Entries last until the exception escapes the query or the query produces an answer,
+// at which point any that are left were caught by Prolog code and are forgotten.
+func (q *query) remember(id int64, cause error) {
+	if q.causes == nil {
+		q.causes = make(map[int64]error)
+	}
+	q.causes[id] = cause
+}
+
+// rememberBall carries the cause of a ball thrown by a nested query over to q.
+func (q *query) rememberBall(ball Term, cause error) {
+	if cause == nil {
+		return
+	}
+	if id, ok := errorToken(ball, func(int64) bool { return true }); ok {
+		q.remember(id, cause)
+	}
+}
+
+// cause returns the Go error behind the first go_error/2 token in ball, if any, and forgets it.
+func (q *query) cause(ball Term) error {
+	if len(q.causes) == 0 {
+		return nil
+	}
+	id, ok := errorToken(ball, func(id int64) bool {
+		_, known := q.causes[id]
+		return known
+	})
+	if !ok {
+		return nil
+	}
+	cause := q.causes[id]
+	delete(q.causes, id)
+	return cause
+}
+
+// errorToken finds the ID of the first go_error(Message, ID) within t that satisfies match.
+func errorToken(t Term, match func(int64) bool) (int64, bool) {
+	switch x := t.(type) {
+	case Compound:
+		if x.Functor == "go_error" && len(x.Args) == 2 {
+			if id, ok := x.Args[1].(int64); ok && match(id) {
+				return id, true
+			}
+		}
+		return errorToken(x.Args, match)
+	case []Term:
+		for _, arg := range x {
+			if id, ok := errorToken(arg, match); ok {
+				return id, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// scrubErrors replaces Go errors within t with go_error(Message, ID) tokens, passing each to found.
+func scrubErrors(t Term, found func(int64, error)) (Term, bool) {
+	switch x := t.(type) {
+	case error:
+		id := goErrors.Add(1)
+		found(id, x)
+		return Atom("go_error").Of(x.Error(), id), true
+	case Compound:
+		args, changed := scrubSlice(x.Args, found)
+		if !changed {
+			return t, false
+		}
+		return Compound{Functor: x.Functor, Args: args}, true
+	case []Term:
+		return scrubSlice(x, found)
+	}
+	return t, false
+}
+
+func scrubSlice(ts []Term, found func(int64, error)) ([]Term, bool) {
+	var scrubbed []Term
+	for i, t := range ts {
+		s, changed := scrubErrors(t, found)
+		if !changed {
+			continue
+		}
+		if scrubbed == nil {
+			scrubbed = make([]Term, len(ts))
+			copy(scrubbed, ts)
+		}
+		scrubbed[i] = s
+	}
+	if scrubbed == nil {
+		return ts, false
+	}
+	return scrubbed, true
+}
+
+// ScanError is returned by [Substitution.Scan] when fields can't be set.
+// It holds every field that failed, not just the first.
+type ScanError struct {
+	// Type is the struct type being scanned into.
+	Type reflect.Type
+	// Fields are the errors for each field, in field order.
+	Fields []FieldError
+}
+
+// Error implements the error interface.
+func (err ScanError) Error() string {
+	msgs := make([]string, len(err.Fields))
+	for i, f := range err.Fields {
+		msgs[i] = f.Error()
+	}
+	return fmt.Sprintf("trealla: error scanning into %v: %s", err.Type, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the errors of the fields that failed.
+func (err ScanError) Unwrap() []error {
+	errs := make([]error, len(err.Fields))
+	for i, f := range err.Fields {
+		errs[i] = f
+	}
+	return errs
+}
+
+// FieldError is a problem scanning into one struct field.
+type FieldError struct {
+	// Field is the name of the field, with the names of its parents for nested structs, such as "Order.Customer".
+	Field string
+	// Path is the variable or dotted path the field was scanned from.
+	Path string
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements the error interface.
+func (err FieldError) Error() string {
+	return fmt.Sprintf("field %q (from %s): %v", err.Field, err.Path, err.Err)
+}
+
+// Unwrap returns the underlying error.
+func (err FieldError) Unwrap() error {
+	return err.Err
+}
+
 func errUnexported(symbol string) error {
 	return fmt.Errorf("trealla: failed to get wasm exported function: %q (symbol not found)", symbol)
 }
@@ -49,4 +222,6 @@ func errUnexported(symbol string) error {
 var (
 	_ error = ErrFailure{}
 	_ error = ErrThrow{}
+	_ error = ScanError{}
+	_ error = FieldError{}
 )
@@ -0,0 +1,110 @@
+package trealla
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestErrorCause(t *testing.T) {
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	errNotFound := errors.New("not found")
+	if err := pl.Register(ctx, "lookup", 1, func(_ Prolog, _ Subquery, goal Term) Term {
+		return systemError(errNotFound)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.Register(ctx, "explode", 0, func(_ Prolog, _ Subquery, goal Term) Term {
+		panic(&fs.PathError{Op: "open", Path: "x", Err: fs.ErrNotExist})
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("errors.Is", func(t *testing.T) {
+		_, err := pl.QueryOnce(ctx, `lookup(X).`)
+		if !errors.Is(err, errNotFound) {
+			t.Fatal("expected errNotFound, got:", err)
+		}
+		var ex ErrThrow
+		if !errors.As(err, &ex) {
+			t.Fatal("expected throw, got:", err)
+		}
+		ball, ok := ex.Ball.(Compound)
+		if !ok || len(ball.Args) != 2 {
+			t.Fatal("unexpected ball:", ex.Ball)
+		}
+		token, ok := ball.Args[1].(Compound)
+		if !ok || token.Functor != "go_error" || token.Args[0] != "not found" {
+			t.Error("unexpected ball:", ex.Ball)
+		}
+	})
+
+	t.Run("errors.As", func(t *testing.T) {
+		_, err := pl.QueryOnce(ctx, `explode.`)
+		var perr *fs.PathError
+		if !errors.As(err, &perr) || perr.Path != "x" {
+			t.Fatal("expected path error, got:", err)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Error("expected fs.ErrNotExist, got:", err)
+		}
+	})
+
+	t.Run("catch/3 sees a term", func(t *testing.T) {
+		ans, err := pl.QueryOnce(ctx, `catch(lookup(_), error(E, go_error(Msg, _)), true).`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ans.Solution["E"] != Atom("system_error") || ans.Solution["Msg"] != "not found" {
+			t.Error("unexpected solution:", ans.Solution)
+		}
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		_, err := pl.QueryOnce(ctx, `call_with_time_limit(1, lookup(_)).`)
+		if !errors.Is(err, errNotFound) {
+			t.Fatal("expected errNotFound, got:", err)
+		}
+	})
+
+	t.Run("rethrown", func(t *testing.T) {
+		_, err := pl.QueryOnce(ctx, `catch(lookup(_), E, true), throw(E).`)
+		if !errors.Is(err, errNotFound) {
+			t.Fatal("expected errNotFound, got:", err)
+		}
+	})
+
+	t.Run("same ball thrown by prolog", func(t *testing.T) {
+		_, err := pl.QueryOnce(ctx, `catch(lookup(_), E, true), E = error(F, go_error(Msg, _)), throw(error(F, go_error(Msg, 0))).`)
+		if errors.Is(err, errNotFound) {
+			t.Error("unexpected cause:", err)
+		}
+	})
+
+	t.Run("caught, then thrown by prolog", func(t *testing.T) {
+		q := pl.Query(ctx, `X = 1, catch(lookup(_), E, true), nb_setval(ball, E) ; X = 2, nb_getval(ball, E), throw(E).`)
+		defer q.Close()
+		if !q.Next(ctx) {
+			t.Fatal(q.Err())
+		}
+		if q.Next(ctx) {
+			t.Fatal("expected exception")
+		}
+		if err := q.Err(); errors.Is(err, errNotFound) {
+			t.Error("unexpected cause:", err)
+		}
+	})
+
+	t.Run("prolog exception", func(t *testing.T) {
+		_, err := pl.QueryOnce(ctx, `throw(error(system_error, "unrelated")).`)
+		if errors.Unwrap(err) != nil {
+			t.Error("unexpected cause:", errors.Unwrap(err))
+		}
+	})
+}
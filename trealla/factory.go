@@ -0,0 +1,150 @@
+package trealla
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Factory hands out blank interpreters, keeping spares ready in the background.
+// Unlike the replicas of a [Pool], interpreters from a Factory share nothing with each other,
+// making them suitable for per-request sandboxes: each has its own shared store and native predicate caches,
+// and channels bound to the template with [Prolog.BindChannel] are not carried over.
+type Factory struct {
+	template *prolog
+	spares   chan spare
+	// room holds a token for each free slot in spares
+	room chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+type spare struct {
+	pl  *prolog
+	err error
+}
+
+// NewFactory creates a Factory that keeps up to spares interpreters created with the given options ready.
+func NewFactory(spares int, options ...Option) (*Factory, error) {
+	if spares < 1 {
+		return nil, fmt.Errorf("trealla: too few spares: %d", spares)
+	}
+	pl, err := New(options...)
+	if err != nil {
+		return nil, err
+	}
+	f := &Factory{
+		template: pl.(*prolog),
+		spares:   make(chan spare, spares),
+		room:     make(chan struct{}, spares),
+		done:     make(chan struct{}),
+	}
+	for range spares {
+		f.room <- struct{}{}
+	}
+	f.wg.Add(1)
+	go f.fill()
+	return f, nil
+}
+
+// Retry delays of fill after failing to make an interpreter.
+const (
+	factoryMinBackoff = 10 * time.Millisecond
+	factoryMaxBackoff = 5 * time.Second
+)
+
+// fill keeps the spares topped up until the factory is closed.
+// A new interpreter is only made once a slot is free, so no more than the spares are alive at once.
+// Errors are handed out like spares, and repeated errors are retried with increasing delays.
+func (f *Factory) fill() {
+	defer f.wg.Done()
+	var backoff time.Duration
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-f.room:
+		}
+
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-f.done:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		pl, err := f.make()
+		if err != nil {
+			backoff = min(max(2*backoff, factoryMinBackoff), factoryMaxBackoff)
+		} else {
+			backoff = 0
+		}
+		// there's a slot for it
+		f.spares <- spare{pl: pl, err: err}
+	}
+}
+
+// make clones the template, cutting its ties to it.
+// Caches of native predicates start out empty, and channel bindings aren't carried over.
+func (f *Factory) make() (*prolog, error) {
+	f.template.mu.Lock()
+	pl, err := f.template.clone()
+	f.template.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	pl.shared = newSharedStore()
+	for pi, cache := range pl.caches {
+		pl.caches[pi], pl.procs[pi] = cache.fork()
+	}
+	pl.chans = make(map[Atom]chan Term)
+	return pl, nil
+}
+
+// Get returns a fresh interpreter, waiting for one to be ready if there are no spares.
+// The caller owns the interpreter and should close it when done.
+// Returns [io.EOF] if the factory is closed.
+func (f *Factory) Get(ctx context.Context) (Prolog, error) {
+	select {
+	case <-f.done:
+		return nil, io.EOF
+	default:
+	}
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("trealla: canceled: %w", ctx.Err())
+	case <-f.done:
+		return nil, io.EOF
+	case s, ok := <-f.spares:
+		if !ok {
+			return nil, io.EOF
+		}
+		f.room <- struct{}{}
+		if s.err != nil {
+			return nil, s.err
+		}
+		return s.pl, nil
+	}
+}
+
+// Close stops making interpreters and destroys the spares.
+// Interpreters that were already handed out are not affected.
+func (f *Factory) Close() {
+	f.once.Do(func() {
+		close(f.done)
+		f.wg.Wait()
+		close(f.spares)
+		for s := range f.spares {
+			if s.pl != nil {
+				s.pl.Close()
+			}
+		}
+		f.template.Close()
+	})
+}
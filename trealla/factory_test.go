@@ -0,0 +1,89 @@
+package trealla
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+func TestFactory(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewFactory(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := f.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := f.Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if _, err := a.QueryOnce(ctx, `assertz(secret(42)), shared_put(secret, 42).`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.QueryOnce(ctx, `\+ catch(secret(_), _, fail), \+ shared_get(secret, _).`); err != nil {
+		t.Error("interpreters share state:", err)
+	}
+
+	f.Close()
+	if _, err := f.Get(ctx); !errors.Is(err, io.EOF) {
+		t.Error("expected io.EOF after Close, got:", err)
+	}
+	// still usable after the factory is closed
+	if _, err := a.QueryOnce(ctx, `secret(42).`); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFactoryIsolation(t *testing.T) {
+	ctx := context.Background()
+	f, err := NewFactory(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var calls atomic.Int32
+	if err := f.template.Register(ctx, "counted", 1, func(_ Prolog, _ Subquery, goal Term) Term {
+		calls.Add(1)
+		return goal
+	}, WithCache(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	f.template.BindChannel("inbox", make(chan Term, 1))
+
+	a, err := f.make()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := f.make()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if a.caches["counted/1"] == b.caches["counted/1"] || a.caches["counted/1"] == f.template.caches["counted/1"] {
+		t.Error("instances share a predicate cache")
+	}
+	for _, pl := range []*prolog{a, b, a} {
+		if _, err := pl.QueryOnce(ctx, `counted(x).`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Error("want 2 uncached calls, got:", n)
+	}
+
+	if len(a.chans) != 0 || len(b.chans) != 0 {
+		t.Error("channel bindings were carried over")
+	}
+}
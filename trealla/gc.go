@@ -0,0 +1,146 @@
+package trealla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"runtime"
+	"sync"
+)
+
+var errCompactInPredicate = errors.New("trealla: can't compact an interpreter within a native predicate")
+
+func (pl *prolog) Compact(ctx context.Context) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.instance == nil {
+		return io.EOF
+	}
+	return pl.compact(ctx)
+}
+
+// compact rebuilds the interpreter in a fresh wasm instance.
+// The knowledgebase is carried over as Prolog text, and global variables as terms.
+func (pl *prolog) compact(ctx context.Context) error {
+	if n := len(pl.open); n > 0 {
+		return fmt.Errorf("trealla: can't compact with %d open queries", n)
+	}
+
+	src, err := pl.source(ctx, sourceOptions{natives: true})
+	if err != nil {
+		return err
+	}
+
+	fresh := &prolog{
+		running:   make(map[uint32]*query),
+		spawning:  make(map[uint32]*query),
+		procs:     maps.Clone(pl.procs),
+		caches:    pl.caches,
+		coros:     make(map[int64]coroutine),
+		alarms:    make(map[int64]*alarm),
+		chans:     pl.chans,
+		shared:    pl.shared,
+		globals:   pl.globals,
+		open:      make(map[uint64]*queryInfo),
+		rt:        pl.rt,
+		dirs:      pl.dirs,
+		fs:        pl.fs,
+		library:   pl.library,
+		trace:     pl.trace,
+		quiet:     pl.quiet,
+		debug:     pl.debug,
+		maxDepth:  pl.maxDepth,
+		textLists: pl.textLists,
+		mu:        new(sync.Mutex),
+	}
+	if err := fresh.init(nil); err != nil {
+		return fmt.Errorf("trealla: compact failed: %w", err)
+	}
+	fresh.mounts.inherit(pl.mounts)
+	fresh.setOperators(pl.operators)
+	// globals go first, before the flags are set, which could change how the values are read
+	for key := range pl.globals {
+		value, err := pl.getGlobal(ctx, key)
+		if IsFailure(err) {
+			continue
+		}
+		if err == nil {
+			err = fresh.setGlobal(ctx, key, value)
+		}
+		if err != nil {
+			fresh.instance.Close(context.Background())
+			return fmt.Errorf("trealla: compact failed to carry over global %s: %w", key, err)
+		}
+	}
+	if err := fresh.load(ctx, src); err != nil {
+		fresh.instance.Close(context.Background())
+		return fmt.Errorf("trealla: compact failed: %w", err)
+	}
+
+	pl.adopt(fresh)
+	return nil
+}
+
+// load consults the source of a knowledgebase.
+func (pl *prolog) load(ctx context.Context, src kbSource) error {
+	for _, op := range src.ops {
+		if _, err := pl.queryOnce(ctx, op.(Compound).String()+"."); err != nil {
+			return err
+		}
+	}
+	for _, ms := range src.modules {
+		if ms.name == "user" {
+			if len(ms.preds) == 0 {
+				continue
+			}
+			if err := pl.consultText(ctx, "user", ms.String()); err != nil {
+				return err
+			}
+			continue
+		}
+		// the module declaration takes care of the rest
+		goal := Atom("load_text").Of(ms.String(), []Term{})
+		if _, err := pl.queryOnce(ctx, goal.String()+"."); err != nil {
+			return fmt.Errorf("trealla: failed to load module %s: %w", ms.name, err)
+		}
+	}
+	for _, flag := range src.flags {
+		if _, err := pl.queryOnce(ctx, flag.(Compound).String()+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// adopt takes over the wasm instance of fresh, closing the current one.
+func (pl *prolog) adopt(fresh *prolog) {
+	runtime.SetFinalizer(fresh, nil)
+	old := pl.instance
+
+	pl.instance = fresh.instance
+	pl.memory = fresh.memory
+	pl.ptr = fresh.ptr
+	pl.realloc = fresh.realloc
+	pl.free = fresh.free
+	pl.pl_consult = fresh.pl_consult
+	pl.pl_capture = fresh.pl_capture
+	pl.pl_capture_read = fresh.pl_capture_read
+	pl.pl_capture_reset = fresh.pl_capture_reset
+	pl.pl_query = fresh.pl_query
+	pl.pl_redo = fresh.pl_redo
+	pl.pl_done = fresh.pl_done
+	pl.pl_yield_at = fresh.pl_yield_at
+	pl.query_did_yield = fresh.query_did_yield
+	pl.procs = fresh.procs
+	pl.mounts = fresh.mounts
+	// host calls find the interpreter through its context
+	pl.ctx = context.WithValue(context.Background(), prologKey{}, pl)
+
+	old.Close(context.Background())
+}
+
+func (pl *lockedProlog) Compact(context.Context) error {
+	return errCompactInPredicate
+}
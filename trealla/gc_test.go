@@ -0,0 +1,109 @@
+package trealla
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestCompact(t *testing.T) {
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := pl.Register(ctx, "twice", 2, func(_ Prolog, _ Subquery, goal Term) Term {
+		g := goal.(Compound)
+		n, _ := g.Args[0].(int64)
+		return Atom("twice").Of(n, n*2)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.ConsultText(ctx, "user", `
+		:- dynamic(counter/1).
+		counter(0).
+		greet(Name, Msg) :- atom_concat('hello ', Name, Msg).
+		quoted('A b', "str", [1, 2|_], - (1), f(-)).
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.ConsultText(ctx, "user", `
+		:- module(mymod, [hello/1]).
+		hello(X) :- helper(X).
+		helper(world).
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pl.QueryOnce(ctx, `retract(counter(0)), assertz(counter(42)), assertz(fact(1)), op(700, xfx, ===>), set_prolog_flag(double_quotes, codes).`); err != nil {
+		t.Fatal(err)
+	}
+	// big transient workload
+	if _, err := pl.QueryOnce(ctx, `\+ \+ (length(L, 200000), maplist(=(x), L)).`); err != nil {
+		t.Fatal(err)
+	}
+	before := pl.Stats().MemorySize
+
+	if err := pl.SetGlobal(ctx, "doc", Atom("doc").Of(Atom("hello"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.Compact(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if after := pl.Stats().MemorySize; after >= before {
+		t.Error("memory didn't shrink:", before, "→", after)
+	}
+
+	ans, err := pl.QueryOnce(ctx, `counter(N), fact(F), greet(bob, Msg), mymod:hello(W), twice(21, X), current_op(P, xfx, ===>), current_prolog_flag(double_quotes, DQ), quoted(A, B, [C|_], D, E), nb_getval(doc, G).`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Substitution{
+		"N":   int64(42),
+		"F":   int64(1),
+		"Msg": Atom("hello bob"),
+		"W":   Atom("world"),
+		"X":   int64(42),
+		"P":   int64(700),
+		"DQ":  Atom("codes"),
+		"A":   Atom("A b"),
+		"B":   "str",
+		"C":   int64(1),
+		"D":   Atom("-").Of(int64(1)),
+		"E":   Atom("f").Of(Atom("-")),
+		"G":   Atom("doc").Of(Atom("hello")),
+	}
+	if !reflect.DeepEqual(want, ans.Solution) {
+		t.Error("want:", want, "got:", ans.Solution)
+	}
+
+	// still dynamic
+	if _, err := pl.QueryOnce(ctx, `assertz(counter(1)), retract(counter(42)).`); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadBaselineRetry(t *testing.T) {
+	baselineMu.Lock()
+	saved := baselineKB
+	baselineKB = nil
+	baselineMu.Unlock()
+	t.Cleanup(func() {
+		baselineMu.Lock()
+		baselineKB = saved
+		baselineMu.Unlock()
+	})
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := loadBaseline(canceled); err == nil {
+		t.Fatal("expected error with canceled context")
+	}
+	base, err := loadBaseline(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(base.modules) == 0 {
+		t.Error("empty baseline")
+	}
+}
@@ -0,0 +1,111 @@
+package trealla
+
+import (
+	"context"
+	"io"
+)
+
+func (pl *prolog) SetGlobal(ctx context.Context, key Atom, value Term) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.instance == nil {
+		return io.EOF
+	}
+	return pl.setGlobal(ctx, key, value)
+}
+
+func (pl *prolog) setGlobal(ctx context.Context, key Atom, value Term) error {
+	_, err := pl.queryOnce(ctx, "nb_setval(Key, Value).", WithBind("Key", key), WithBind("Value", value))
+	return err
+}
+
+func (pl *prolog) GetGlobal(ctx context.Context, key Atom) (Term, error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.instance == nil {
+		return nil, io.EOF
+	}
+	return pl.getGlobal(ctx, key)
+}
+
+func (pl *prolog) getGlobal(ctx context.Context, key Atom) (Term, error) {
+	ans, err := pl.queryOnce(ctx, "catch(nb_getval(Key, Value), error(existence_error(variable, Key), _), fail).", WithBind("Key", key))
+	if err != nil {
+		return nil, err
+	}
+	return ans.Solution["Value"], nil
+}
+
+func (pl *lockedProlog) SetGlobal(ctx context.Context, key Atom, value Term) error {
+	if err := pl.ensure(); err != nil {
+		return err
+	}
+	return pl.prolog.setGlobal(ctx, key, value)
+}
+
+func (pl *lockedProlog) GetGlobal(ctx context.Context, key Atom) (Term, error) {
+	if err := pl.ensure(); err != nil {
+		return nil, err
+	}
+	return pl.prolog.getGlobal(ctx, key)
+}
+
+// WithGlobal sets the global variable key to value for the duration of the query, as in b_setval/2.
+// It is read with b_getval/2 or nb_getval/2 like the globals set by [Prolog.SetGlobal], which it shadows,
+// and is discarded when the query finishes.
+func WithGlobal(key Atom, value Term) QueryOption {
+	return func(q *query) {
+		put := Atom("b_setval").Of(key, value)
+		for i, g := range q.globals {
+			if g.Args[0] == key {
+				q.globals[i] = put
+				return
+			}
+		}
+		q.globals = append(q.globals, put)
+	}
+}
+
+// Global variables are kept in Trealla's blackboard (bb_put/2, bb_get/2).
+// This build of Trealla lacks nb_setval/2 and friends, so they're native predicates on top of it.
+
+// nb_setval(+Key, +Value)
+func nb_setval_2(pl Prolog, subquery Subquery, goal Term) Term {
+	g := goal.(Compound)
+	if host, _ := native(pl, subquery); host != nil {
+		if key, ok := g.Args[0].(Atom); ok {
+			// remembered so that Compact can carry it over
+			host.globals[key] = struct{}{}
+		}
+	}
+	return Atom("call").Of(Atom("bb_put").Of(g.Args[0], g.Args[1]))
+}
+
+// b_setval(+Key, +Value)
+func b_setval_2(_ Prolog, _ Subquery, goal Term) Term {
+	g := goal.(Compound)
+	// bb_b_put/2 is only undone when called through call/1 from within a clause, as the continuation is
+	return Atom("call").Of(Atom("bb_b_put").Of(g.Args[0], g.Args[1]))
+}
+
+// nb_getval(+Key, -Value)
+func nb_getval_2(_ Prolog, _ Subquery, goal Term) Term {
+	return getval(goal.(Compound))
+}
+
+// b_getval(+Key, -Value)
+func b_getval_2(_ Prolog, _ Subquery, goal Term) Term {
+	return getval(goal.(Compound))
+}
+
+// getval calls bb_get/2, throwing an existence error for unset keys.
+func getval(g Compound) Term {
+	v := Variable{Name: "_Value"}
+	return Atom("call").Of(Atom(";").Of(
+		Atom("->").Of(
+			Atom("bb_get").Of(g.Args[0], v),
+			Atom("=").Of(g.Args[1], v),
+		),
+		existenceError("variable", g.Args[0], g.pi()),
+	))
+}
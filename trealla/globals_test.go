@@ -0,0 +1,104 @@
+package trealla
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGlobals(t *testing.T) {
+	ctx := context.Background()
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Close()
+
+	doc := Atom("request").Of(Atom("user").Of("alice"), []Term{int64(1), int64(2)})
+	if err := pl.SetGlobal(ctx, "doc", doc); err != nil {
+		t.Fatal(err)
+	}
+	got, err := pl.GetGlobal(ctx, "doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, doc) {
+		t.Error("want:", doc, "got:", got)
+	}
+
+	if err := pl.ConsultText(ctx, "user", `user_name(Name) :- nb_getval(doc, request(user(Name), _)).`); err != nil {
+		t.Fatal(err)
+	}
+	ans, err := pl.QueryOnce(ctx, `user_name(X).`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := ans.Solution["X"]; x != "alice" {
+		t.Error("want: alice got:", x)
+	}
+
+	if _, err := pl.GetGlobal(ctx, "missing"); !IsFailure(err) {
+		t.Error("expected failure, got:", err)
+	}
+
+	t.Run("WithGlobal", func(t *testing.T) {
+		other := Atom("request").Of(Atom("user").Of("bob"), []Term{})
+		ans, err := pl.QueryOnce(ctx, `user_name(X), b_getval(tmp, Y).`, WithGlobal("doc", other), WithGlobal("tmp", int64(1)), WithGlobal("tmp", int64(2)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Substitution{"X": "bob", "Y": int64(2)}
+		if !reflect.DeepEqual(ans.Solution, want) {
+			t.Error("want:", want, "got:", ans.Solution)
+		}
+
+		// only for that query
+		got, err := pl.GetGlobal(ctx, "doc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, doc) {
+			t.Error("want:", doc, "got:", got)
+		}
+		if _, err := pl.GetGlobal(ctx, "tmp"); !IsFailure(err) {
+			t.Error("expected failure, got:", err)
+		}
+	})
+
+	t.Run("b_setval is undone on backtracking", func(t *testing.T) {
+		ans, err := pl.QueryOnce(ctx, `nb_setval(n, 1), (b_setval(n, 2), b_getval(n, 2), fail ; b_getval(n, X)).`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if x := ans.Solution["X"]; x != int64(1) {
+			t.Error("want: 1 got:", x)
+		}
+	})
+
+	t.Run("unset", func(t *testing.T) {
+		_, err := pl.QueryOnce(ctx, `nb_getval(missing, _).`)
+		var ex ErrThrow
+		if !errors.As(err, &ex) {
+			t.Fatal("expected throw, got:", err)
+		}
+		want := Atom("error").Of(Atom("existence_error").Of(Atom("variable"), Atom("missing")), piTerm("nb_getval", 2))
+		if !reflect.DeepEqual(ex.Ball, want) {
+			t.Error("want:", want, "got:", ex.Ball)
+		}
+	})
+
+	t.Run("not in user", func(t *testing.T) {
+		var buf strings.Builder
+		if err := pl.Dump(ctx, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(buf.String(), "bb_") {
+			t.Error("dump lists globals:", buf.String())
+		}
+		if _, err := pl.QueryOnce(ctx, `clause(nb_getval(_, _), bb_get(_, _)).`); err == nil {
+			t.Error("globals are clauses in user")
+		}
+	})
+}
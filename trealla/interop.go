@@ -29,26 +29,36 @@ type Subquery uint32
 type coroutine struct {
 	next func() (Term, bool)
 	stop func()
+	redo bool
 }
 
 type coroer interface {
 	CoroStart(subq Subquery, seq iter.Seq[Term]) int64
-	CoroNext(subq Subquery, id int64) (Term, bool)
+	CoroNext(subq Subquery, id int64, goal Term) (Term, bool)
 	CoroStop(subq Subquery, id int64)
 }
 
-func (pl *prolog) Register(ctx context.Context, name string, arity int, proc Predicate) error {
+func (pl *prolog) Register(ctx context.Context, name string, arity int, proc Predicate, options ...RegisterOption) error {
 	pl.mu.Lock()
 	defer pl.mu.Unlock()
 	if pl.instance == nil {
 		return io.EOF
 	}
-	return pl.register(ctx, name, arity, proc)
+	return pl.register(ctx, name, arity, proc, options...)
 }
 
-func (pl *prolog) register(ctx context.Context, name string, arity int, proc Predicate) error {
+func (pl *prolog) register(ctx context.Context, name string, arity int, proc Predicate, options ...RegisterOption) error {
+	var reg registration
+	for _, opt := range options {
+		opt(&reg)
+	}
 	functor := Atom(name)
 	pi := piTerm(functor, arity)
+	delete(pl.caches, pi.String())
+	if reg.cache != nil {
+		pl.caches[pi.String()] = reg.cache
+		proc = reg.cache.wrap(proc)
+	}
 	pl.procs[pi.String()] = proc
 	vars := numbervars(arity)
 	head := functor.Of(vars...)
@@ -90,7 +100,7 @@ func sys_coro_next_2(pl Prolog, subquery Subquery, goal Term) Term {
 	if !ok {
 		return throwTerm(domainError("integer", g.Args[0], g.pi()))
 	}
-	result, ok := plc.CoroNext(subquery, id)
+	result, ok := plc.CoroNext(subquery, id, g.Args[1])
 	if !ok || result == nil {
 		return Atom("fail")
 	}
@@ -132,11 +142,24 @@ func (pl *prolog) CoroStart(subq Subquery, seq iter.Seq[Term]) int64 {
 	return id
 }
 
-func (pl *prolog) CoroNext(subq Subquery, id int64) (Term, bool) {
+// CoroNext returns the next solution of a coroutine started for goal.
+// Retries count as calls of goal, so they're subject to the query's limits.
+func (pl *prolog) CoroNext(subq Subquery, id int64, goal Term) (Term, bool) {
 	coro, ok := pl.coros[id]
 	if !ok {
 		return Atom("false"), false
 	}
+	if g, ok := goal.(atomicTerm); ok && coro.redo {
+		if query := pl.subquery(uint32(subq)); query != nil {
+			if ex, ok := query.limits.check(g); !ok {
+				return ex, true
+			}
+		}
+	}
+	if !coro.redo {
+		coro.redo = true
+		pl.coros[id] = coro
+	}
 	next, ok := coro.next()
 	if !ok {
 		delete(pl.coros, id)
@@ -163,8 +186,8 @@ func (pl *lockedProlog) CoroStart(subq Subquery, seq iter.Seq[Term]) int64 {
 	return pl.prolog.CoroStart(subq, seq)
 }
 
-func (pl *lockedProlog) CoroNext(subq Subquery, id int64) (Term, bool) {
-	return pl.prolog.CoroNext(subq, id)
+func (pl *lockedProlog) CoroNext(subq Subquery, id int64, goal Term) (Term, bool) {
+	return pl.prolog.CoroNext(subq, id, goal)
 }
 
 func (pl *lockedProlog) CoroStop(subq Subquery, id int64) {
@@ -185,7 +208,7 @@ func hostCall(ctx context.Context, subquery, msgptr, msgsize, reply_pp, replysiz
 		panic(err)
 	}
 
-	msg, err := unmarshalTerm([]byte(msgraw))
+	msg, err := unmarshalTerm([]byte(msgraw), termDecoder{maxDepth: pl.maxDepth})
 	if err != nil {
 		err = fmt.Errorf("%w (raw msg: %s)", err, msgraw)
 		panic(err)
@@ -223,6 +246,13 @@ func hostCall(ctx context.Context, subquery, msgptr, msgsize, reply_pp, replysiz
 		return wasmTrue
 	}
 
+	if ex, ok := subq.limits.check(goal); !ok {
+		if err := reply(ex.String()); err != nil {
+			panic(err)
+		}
+		return wasmTrue
+	}
+
 	if err := subq.readOutput(); err != nil {
 		panic(err)
 	}
@@ -231,10 +261,20 @@ func hostCall(ctx context.Context, subquery, msgptr, msgsize, reply_pp, replysiz
 	locked := &lockedProlog{prolog: pl}
 	continuation := catch(proc, locked, Subquery(subquery), goal)
 	locked.kill()
-	expr, err := marshal(continuation)
+	continuation = subq.capture(continuation)
+	expr, err := marshalOps(continuation, pl.ops)
 	if err != nil {
 		panic(err)
 	}
+
+	if sus := subq.suspended; sus != nil && sus.wait != nil {
+		// yield to the host, replying later in hostResume
+		if err := subq.readOutput(); err != nil {
+			panic(err)
+		}
+		return wasmYield
+	}
+
 	if err := reply(expr); err != nil {
 		panic(err)
 	}
@@ -257,6 +297,13 @@ func catch(pred Predicate, pl Prolog, subq Subquery, goal Term) (result Term) {
 				} else {
 					result = throwTerm(ball)
 				}
+			case error:
+				result = throwTerm(
+					Atom("system_error").Of(
+						Atom("panic").Of(ball),
+						goal.(atomicTerm).pi(),
+					),
+				)
 			default:
 				result = throwTerm(
 					Atom("system_error").Of(
@@ -271,9 +318,24 @@ func catch(pred Predicate, pl Prolog, subq Subquery, goal Term) (result Term) {
 	return
 }
 
-func hostResume(_, _, _ uint32) uint32 {
+func hostResume(ctx context.Context, subquery, reply_pp, replysize_p uint32) uint32 {
 	// extern int32_t host_resume(int32_t subquery, char **reply, size_t *reply_size);
-	return wasmFalse
+	pl := ctx.Value(prologKey{}).(*prolog)
+
+	subq := pl.subquery(subquery)
+	if subq == nil || subq.suspended == nil || subq.suspended.wait != nil {
+		return wasmFalse
+	}
+	sus := subq.suspended
+	subq.suspended = nil
+
+	msg, err := newCString(pl, sus.reply)
+	if err != nil {
+		panic(err)
+	}
+	pl.memory.WriteUint32Le(reply_pp, msg.ptr)
+	pl.memory.WriteUint32Le(replysize_p, uint32(msg.size-1))
+	return wasmTrue
 }
 
 var (
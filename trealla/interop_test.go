@@ -59,6 +59,15 @@ func TestInterop(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "crypto_data_hash/3 options",
+			want: []Answer{
+				{
+					Query:    `catch(crypto_data_hash("foo", _, [bogus(1)]), error(domain_error(option, bogus(1)), _), true), catch(crypto_data_hash("foo", _, [algorithm(1)]), error(type_error(atom, 1), _), true).`,
+					Solution: Substitution{},
+				},
+			},
+		},
 		{
 			name: "http_consult/1",
 			want: []Answer{
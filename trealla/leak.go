@@ -0,0 +1,176 @@
+package trealla
+
+import (
+	"errors"
+	"runtime/debug"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// ErrIdleTimeout is the error of a query that was closed by [WithQueryIdleTimeout].
+var ErrIdleTimeout = errors.New("trealla: query closed after being idle")
+
+// QueryInfo describes a query that hasn't been closed yet.
+type QueryInfo struct {
+	// Goal is the query text.
+	Goal string
+	// Created is when the query started.
+	Created time.Time
+	// LastUsed is when the query was last advanced.
+	LastUsed time.Time
+	// Stack is the stack trace of the query's creation.
+	// It is only recorded when [WithLeakDetection] is enabled.
+	Stack string
+}
+
+// queryInfo is the bookkeeping for an open query.
+// It doesn't reference the query itself so it doesn't prevent finalizers from running.
+type queryInfo struct {
+	goal    string
+	created time.Time
+	used    atomic.Int64 // unix nanos
+	stack   []byte
+}
+
+func (info *queryInfo) export() QueryInfo {
+	return QueryInfo{
+		Goal:     info.goal,
+		Created:  info.created,
+		LastUsed: info.lastUsed(),
+		Stack:    string(info.stack),
+	}
+}
+
+func (info *queryInfo) lastUsed() time.Time {
+	return time.Unix(0, info.used.Load())
+}
+
+// WithQueryIdleTimeout closes queries that haven't been advanced (by calling Next) for d.
+// Reaped queries report [ErrIdleTimeout] from their Err method.
+// Only queries created by [Prolog.Query] are reaped, not those created within native predicates.
+func WithQueryIdleTimeout(d time.Duration) Option {
+	return func(pl *prolog) {
+		pl.idleTimeout = d
+	}
+}
+
+// WithLeakDetection records the creation stack of each query and calls hook
+// for queries that are garbage collected or reaped by [WithQueryIdleTimeout] without being closed.
+// hook is called in its own goroutine and may be nil, in which case leaks are only counted in [Stats].
+// Queries with remaining choice points are referenced by the interpreter until they are closed,
+// so use this together with [WithQueryIdleTimeout] to catch those.
+// This is intended for debugging: capturing stacks is slow.
+func WithLeakDetection(hook func(QueryInfo)) Option {
+	return func(pl *prolog) {
+		pl.leakDetection = true
+		pl.leakHook = hook
+	}
+}
+
+func (pl *prolog) OpenQueries() []QueryInfo {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	return pl.openQueries()
+}
+
+func (pl *prolog) openQueries() []QueryInfo {
+	infos := make([]QueryInfo, 0, len(pl.open))
+	for _, info := range pl.open {
+		infos = append(infos, info.export())
+	}
+	slices.SortFunc(infos, func(a, b QueryInfo) int {
+		return a.Created.Compare(b.Created)
+	})
+	return infos
+}
+
+func (pl *lockedProlog) OpenQueries() []QueryInfo {
+	if err := pl.ensure(); err != nil {
+		return nil
+	}
+	return pl.prolog.openQueries()
+}
+
+// track registers a newly created query as open.
+func (pl *prolog) track(q *query) {
+	now := time.Now()
+	q.info = &queryInfo{
+		goal:    q.goal,
+		created: now,
+	}
+	q.info.used.Store(now.UnixNano())
+	if pl.leakDetection {
+		q.info.stack = debug.Stack()
+	}
+	pl.openn++
+	q.id = pl.openn
+	pl.open[q.id] = q.info
+
+	if pl.idleTimeout > 0 && q.lock {
+		q.idle = time.AfterFunc(pl.idleTimeout, q.reap)
+	}
+}
+
+func (pl *prolog) untrack(q *query) {
+	if q.info == nil {
+		return
+	}
+	delete(pl.open, q.id)
+	if q.idle != nil {
+		q.idle.Stop()
+	}
+}
+
+// leaked reports a query that wasn't closed by its user.
+func (pl *prolog) leaked(q *query) {
+	if q.info == nil {
+		return
+	}
+	pl.leaks++
+	if pl.debug != nil {
+		pl.debug.Println("leaked query:", q.goal)
+	}
+	if pl.leakHook != nil {
+		go pl.leakHook(q.info.export())
+	}
+}
+
+// touch marks the query as used, postponing its idle timeout.
+func (q *query) touch() {
+	if q.info == nil {
+		return
+	}
+	q.info.used.Store(time.Now().UnixNano())
+	if q.idle != nil && !q.dead {
+		q.idle.Reset(q.pl.idleTimeout)
+	}
+}
+
+// reap closes a query that has been idle for too long.
+func (q *query) reap() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.dead || time.Since(q.info.lastUsed()) < q.pl.idleTimeout {
+		return
+	}
+
+	q.pl.mu.Lock()
+	defer q.pl.mu.Unlock()
+	if q.pl.debug != nil {
+		q.pl.debug.Println("reaping idle query:", q.goal)
+	}
+	q.pl.leaked(q)
+	q.setError(ErrIdleTimeout)
+	q.close()
+}
+
+// finalize is the finalizer of queries returned by [Prolog.Query].
+func (q *query) finalize() {
+	if !q.dead && q.pl != nil {
+		q.pl.mu.Lock()
+		q.pl.leaked(q)
+		q.pl.mu.Unlock()
+	}
+	q.Close()
+}
@@ -0,0 +1,97 @@
+package trealla
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenQueries(t *testing.T) {
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	q := pl.Query(ctx, `between(1, 1000000, X).`)
+	if !q.Next(ctx) {
+		t.Fatal("no answer:", q.Err())
+	}
+	open := pl.OpenQueries()
+	if len(open) != 1 || open[0].Goal != `between(1, 1000000, X).` {
+		t.Fatal("unexpected open queries:", open)
+	}
+	if stats := pl.Stats(); stats.OpenQueries != 1 {
+		t.Error("unexpected stats:", stats)
+	}
+	q.Close()
+	if open := pl.OpenQueries(); len(open) != 0 {
+		t.Error("query still open after Close:", open)
+	}
+}
+
+func TestQueryIdleTimeout(t *testing.T) {
+	pl, err := New(WithQueryIdleTimeout(50 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	q := pl.Query(ctx, `between(1, 1000000, X).`)
+	// keep it busy for longer than the timeout
+	for range 4 {
+		if !q.Next(ctx) {
+			t.Fatal("no answer:", q.Err())
+		}
+		time.Sleep(25 * time.Millisecond)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if q.Next(ctx) {
+		t.Error("reaped query returned an answer")
+	}
+	if !errors.Is(q.Err(), ErrIdleTimeout) {
+		t.Error("expected ErrIdleTimeout, got:", q.Err())
+	}
+	stats := pl.Stats()
+	if stats.OpenQueries != 0 || stats.LeakedQueries != 1 {
+		t.Error("unexpected stats:", stats)
+	}
+}
+
+func TestLeakDetection(t *testing.T) {
+	leaks := make(chan QueryInfo, 1)
+	pl, err := New(
+		WithQueryIdleTimeout(10*time.Millisecond),
+		WithLeakDetection(func(info QueryInfo) {
+			leaks <- info
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	func() {
+		q := pl.Query(ctx, `between(1, 3, X).`)
+		q.Next(ctx)
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case info := <-leaks:
+			if info.Goal != `between(1, 3, X).` {
+				t.Error("unexpected goal:", info.Goal)
+			}
+			if !strings.Contains(info.Stack, "TestLeakDetection") {
+				t.Error("stack doesn't mention the test:", info.Stack)
+			}
+			return
+		case <-deadline:
+			t.Fatal("leak wasn't reported")
+		}
+	}
+}
@@ -7,25 +7,69 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 )
 
-var builtins = []struct {
+type builtinPredicate struct {
 	name  string
 	arity int
 	proc  Predicate
-}{
-	{"$coro_next", 2, sys_coro_next_2},
-	{"$coro_stop", 1, sys_coro_stop_1},
-	{"crypto_data_hash", 3, crypto_data_hash_3},
-	{"http_consult", 1, http_consult_1},
-	{"http_fetch", 3, http_fetch_3},
 }
 
+var builtins []builtinPredicate
+
+func init() {
+	// assigned here because the predicates run queries, and queries can start an interpreter (see loadBaseline)
+	builtins = []builtinPredicate{
+		{"$concurrent", 1, sys_concurrent_1},
+		{"$coro_next", 2, sys_coro_next_2},
+		{"$coro_stop", 1, sys_coro_stop_1},
+		{"alarm", 3, alarm_3},
+		{"b_getval", 2, b_getval_2},
+		{"b_setval", 2, b_setval_2},
+		{"chan_recv", 2, chan_recv_2},
+		{"chan_send", 2, chan_send_2},
+		{"concurrent_forall", 2, concurrent_forall_2},
+		{"concurrent_maplist", 2, concurrent_maplist_2},
+		{"concurrent_maplist", 3, concurrent_maplist_3},
+		{"crypto_data_hash", 3, crypto_data_hash_3},
+		{"http_consult", 1, http_consult_1},
+		{"http_fetch", 3, http_fetch_3},
+		{"nb_getval", 2, nb_getval_2},
+		{"nb_setval", 2, nb_setval_2},
+		{"remove_alarm", 1, remove_alarm_1},
+		{"shared_cas", 3, shared_cas_3},
+		{"shared_delete", 1, shared_delete_1},
+		{"shared_get", 2, shared_get_2},
+		{"shared_put", 2, shared_put_2},
+	}
+}
+
+// builtin reports whether pi, such as "foo/2", is defined by loadBuiltins.
+func builtin(pi string) bool {
+	if pi == "call_with_time_limit/2" {
+		// from builtinsLibrary
+		return true
+	}
+	return slices.ContainsFunc(builtins, func(b builtinPredicate) bool {
+		return piTerm(Atom(b.name), b.arity).String() == pi
+	})
+}
+
+// builtinsLibrary defines builtins whose Go predicate is called through a helper clause.
+// Trealla's library version of call_with_time_limit/2, which doesn't work in WebAssembly,
+// takes over from a plain shim once a call throws.
+const builtinsLibrary = `
+call_with_time_limit(Time, Goal) :- '$call_with_time_limit'(Time, Goal).
+'$call_with_time_limit'(Time, Goal) :- wasm_generic:host_rpc(call_with_time_limit(Time, Goal)).
+`
+
 func (pl *prolog) loadBuiltins() error {
 	ctx := context.Background()
 	for _, predicate := range builtins {
@@ -33,7 +77,15 @@ func (pl *prolog) loadBuiltins() error {
 			return err
 		}
 	}
-	return nil
+	pl.procs[piTerm("call_with_time_limit", 2).String()] = call_with_time_limit_2
+	return pl.consultText(ctx, "user", builtinsLibrary)
+}
+
+// httpFetchOptions are the options of http_fetch/3.
+type httpFetchOptions struct {
+	Method Atom   `prolog:"method"`
+	As     Atom   `prolog:"as"`
+	Body   string `prolog:"body"`
 }
 
 // TODO: needs to support forms, headers, etc.
@@ -51,15 +103,20 @@ func http_fetch_3(_ Prolog, _ Subquery, goal Term) Term {
 		return domainError("url", cmp.Args[0], piTerm("http_fetch", 3))
 	}
 
-	method := findOption[Atom](opts, "method", "get")
-	as := findOption[Atom](opts, "as", "string")
-	bodystr := findOption(opts, "body", "")
+	options := httpFetchOptions{Method: "get", As: "string"}
+	if err := DecodeOptions(opts, &options); err != nil {
+		var optErr OptionError
+		if errors.As(err, &optErr) {
+			return optErr.Throw(piTerm("http_fetch", 3))
+		}
+		return systemError(err.Error())
+	}
 	var body io.Reader
-	if bodystr != "" {
-		body = strings.NewReader(bodystr)
+	if options.Body != "" {
+		body = strings.NewReader(options.Body)
 	}
 
-	req, err := http.NewRequest(strings.ToUpper(string(method)), href.String(), body)
+	req, err := http.NewRequest(strings.ToUpper(string(options.Method)), href.String(), body)
 	if err != nil {
 		return domainError("url", cmp.Args[0], err.Error())
 	}
@@ -89,7 +146,7 @@ func http_fetch_3(_ Prolog, _ Subquery, goal Term) Term {
 		return resourceError(Atom(err.Error()), piTerm("http_fetch", 3))
 	}
 
-	switch as {
+	switch options.As {
 	case "json":
 		js := Variable{Name: "_JS"}
 		return Atom("call").Of(Atom(",").Of(Atom("=").Of(result, js), Atom("json_chars").Of(js, buf.String())))
@@ -166,6 +223,10 @@ func http_consult_1(_ Prolog, _ Subquery, goal Term) Term {
 	return Atom("call").Of(Atom("load_text").Of(buf.String(), []Term{Atom("module").Of(module)}))
 }
 
+type cryptoHashOptions struct {
+	Algorithm Atom `prolog:"algorithm"`
+}
+
 func crypto_data_hash_3(pl Prolog, _ Subquery, goal Term) Term {
 	cmp, ok := goal.(Compound)
 	if !ok {
@@ -186,10 +247,27 @@ func crypto_data_hash_3(pl Prolog, _ Subquery, goal Term) Term {
 	default:
 		return typeError("chars", hash, piTerm("crypto_data_hash", 3))
 	}
-	if !isList(opts) {
-		return typeError("list", opts, piTerm("crypto_data_hash", 3))
+	options := cryptoHashOptions{Algorithm: "sha256"}
+	// algorithm(A) with A unbound reports the default
+	if list, ok := opts.([]Term); ok {
+		bound := slices.Clone(list)
+		for i, x := range list {
+			if x, ok := x.(Compound); ok && x.Functor == "algorithm" && len(x.Args) == 1 {
+				if _, ok := x.Args[0].(Variable); ok {
+					bound[i] = x.Functor.Of(options.Algorithm)
+				}
+			}
+		}
+		opts = bound
+	}
+	if err := DecodeOptions(opts, &options); err != nil {
+		var optErr OptionError
+		if errors.As(err, &optErr) {
+			return optErr.Throw(piTerm("crypto_data_hash", 3))
+		}
+		return systemError(err.Error())
 	}
-	algo := findOption[Atom](opts, "algorithm", "sha256")
+	algo := options.Algorithm
 	var digest []byte
 	switch algo {
 	case Atom("sha256"):
@@ -234,40 +312,3 @@ func systemError(ctx Term) Compound {
 func throwTerm(ball Term) Compound {
 	return Compound{Functor: "throw", Args: []Term{ball}}
 }
-
-func findOption[T Term](opts Term, functor Atom, fallback T) T {
-	if empty, ok := opts.(Atom); ok && empty == "[]" {
-		return fallback
-	}
-	list, ok := opts.([]Term)
-	if !ok {
-		var empty T
-		return empty
-	}
-	for i, x := range list {
-		switch x := x.(type) {
-		case Compound:
-			if x.Functor != functor || len(x.Args) != 1 {
-				continue
-			}
-			switch arg := x.Args[0].(type) {
-			case T:
-				return arg
-			case Variable:
-				list[i] = functor.Of(fallback)
-				return fallback
-			}
-		}
-	}
-	return fallback
-}
-
-func isList(x Term) bool {
-	switch x := x.(type) {
-	case []Term:
-		return true
-	case Atom:
-		return x == "[]"
-	}
-	return false
-}
@@ -0,0 +1,116 @@
+package trealla
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// guard restricts which native predicates a query may call and how often.
+// It is shared with nested queries started on the query's behalf.
+type guard struct {
+	allow  map[string]struct{} // nil allows everything
+	limits map[string]*callLimit
+}
+
+// callLimit is safe for concurrent use, as nested queries may run in parallel.
+type callLimit struct {
+	max   int
+	per   time.Duration
+	calls []time.Time
+	mu    sync.Mutex
+}
+
+// WithAllowedPredicates restricts the native Go predicates a query may call to the given predicate indicators, such as "foo/2".
+// This applies to builtins implemented in Go (such as "http_fetch/3") as well as ones added by [Prolog.Register].
+// Calling any other native predicate throws a permission_error.
+// Multiple uses of this option combine their lists.
+// Trealla's own builtins, which aren't implemented in Go, can't be restricted.
+func WithAllowedPredicates(pis ...string) QueryOption {
+	return func(q *query) {
+		g := q.guard()
+		if g.allow == nil {
+			g.allow = make(map[string]struct{}, len(pis))
+		}
+		for _, pi := range pis {
+			g.allow[pi] = struct{}{}
+		}
+	}
+}
+
+// WithCallLimit limits how many times a query may call the native Go predicate pi, such as "foo/2".
+// If per is zero, the predicate may be called at most max times over the lifetime of the query.
+// Otherwise, it may be called at most max times in any span of per.
+// Every retry of a nondeterministic predicate counts as a call.
+// Exceeding the limit throws a resource_error.
+// Trealla's own builtins, which aren't implemented in Go, can't be limited.
+func WithCallLimit(pi string, max int, per time.Duration) QueryOption {
+	return func(q *query) {
+		g := q.guard()
+		if g.limits == nil {
+			g.limits = make(map[string]*callLimit)
+		}
+		g.limits[pi] = &callLimit{max: max, per: per}
+	}
+}
+
+// withGuard shares the restrictions of a parent query.
+func withGuard(g *guard) QueryOption {
+	return func(q *query) {
+		q.limits = g
+	}
+}
+
+func (q *query) guard() *guard {
+	if q.limits == nil {
+		q.limits = new(guard)
+	}
+	return q.limits
+}
+
+// check reports whether goal may be called, returning an exception if it can't.
+func (g *guard) check(goal atomicTerm) (Compound, bool) {
+	if g == nil {
+		return Compound{}, true
+	}
+	ind := goal.pi()
+	pi := ind.String()
+	if g.allow != nil && !internal(ind) {
+		if _, ok := g.allow[pi]; !ok {
+			return throwTerm(Atom("error").Of(
+				Atom("permission_error").Of(Atom("execute"), Atom("procedure"), ind),
+				piTerm("$host_call", 2),
+			)), false
+		}
+	}
+	if limit, ok := g.limits[pi]; ok && !limit.take(time.Now()) {
+		return resourceError("host_calls", ind), false
+	}
+	return Compound{}, true
+}
+
+func (limit *callLimit) take(now time.Time) bool {
+	limit.mu.Lock()
+	defer limit.mu.Unlock()
+	if limit.per > 0 {
+		// forget calls that fell out of the window
+		cutoff := now.Add(-limit.per)
+		i := 0
+		for i < len(limit.calls) && !limit.calls[i].After(cutoff) {
+			i++
+		}
+		limit.calls = limit.calls[i:]
+	}
+	if len(limit.calls) >= limit.max {
+		return false
+	}
+	limit.calls = append(limit.calls, now)
+	return true
+}
+
+// internal reports whether pi is one of our own helpers, such as '$coro_next'/2.
+// These are always allowed so that permitted predicates keep working.
+func internal(pi Compound) bool {
+	functor, _ := pi.Args[0].(Atom)
+	return strings.HasPrefix(string(functor), "$")
+}
@@ -0,0 +1,115 @@
+package trealla
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAllowedPredicates(t *testing.T) {
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registerNap(t, pl)
+	ctx := context.Background()
+
+	ok := func(_ Prolog, _ Subquery, goal Term) Term { return goal }
+	if err := pl.Register(ctx, "safe", 0, ok); err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.Register(ctx, "paid", 0, ok); err != nil {
+		t.Fatal(err)
+	}
+	if err := pl.RegisterNondet(ctx, "pick", 1, func(_ Prolog, _ Subquery, goal Term) iter.Seq[Term] {
+		return func(yield func(Term) bool) {
+			for i := int64(1); i <= 3; i++ {
+				if !yield(Atom("pick").Of(i)) {
+					return
+				}
+			}
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	denied := func(pi Term) Term {
+		return Atom("error").Of(
+			Atom("permission_error").Of(Atom("execute"), Atom("procedure"), pi),
+			piTerm("$host_call", 2),
+		)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		options []QueryOption
+		want    Term // exception
+	}{
+		{
+			name:  "unrestricted",
+			query: `safe, paid.`,
+		},
+		{
+			name:    "allowed",
+			query:   `safe, findall(X, pick(X), [1, 2, 3]).`,
+			options: []QueryOption{WithAllowedPredicates("safe/0", "pick/1")},
+		},
+		{
+			name:    "denied",
+			query:   `safe, paid.`,
+			options: []QueryOption{WithAllowedPredicates("safe/0")},
+			want:    denied(piTerm("paid", 0)),
+		},
+		{
+			name:    "builtin",
+			query:   `crypto_data_hash(abc, _, []).`,
+			options: []QueryOption{WithAllowedPredicates("safe/0")},
+			want:    denied(piTerm("crypto_data_hash", 3)),
+		},
+		{
+			name:    "nested",
+			query:   `call_with_time_limit(1, paid).`,
+			options: []QueryOption{WithAllowedPredicates("call_with_time_limit/2")},
+			want:    denied(piTerm("paid", 0)),
+		},
+		{
+			name:    "max calls",
+			query:   `paid, paid, paid.`,
+			options: []QueryOption{WithCallLimit("paid/0", 2, 0)},
+			want:    Atom("error").Of(Atom("resource_error").Of(Atom("host_calls")), piTerm("paid", 0)),
+		},
+		{
+			name:    "max calls with retries",
+			query:   `findall(X, pick(X), _).`,
+			options: []QueryOption{WithCallLimit("pick/1", 2, 0)},
+			want:    Atom("error").Of(Atom("resource_error").Of(Atom("host_calls")), piTerm("pick", 1)),
+		},
+		{
+			name:    "rate",
+			query:   `paid, paid, nap(0.05), paid, paid.`,
+			options: []QueryOption{WithCallLimit("paid/0", 2, 20*time.Millisecond)},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := pl.QueryOnce(ctx, tc.query, tc.options...)
+			if tc.want == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			var ex ErrThrow
+			if !errors.As(err, &ex) {
+				t.Fatal("expected throw, got:", err)
+			}
+			if !reflect.DeepEqual(tc.want, ex.Ball) {
+				t.Error("want:", tc.want, "got:", ex.Ball)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package trealla
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"path"
+	"strings"
+	"sync"
+
+	experimentalsys "github.com/tetratelabs/wazero/experimental/sys"
+	"github.com/tetratelabs/wazero/experimental/sysfs"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// mountTable is the file system mounted at the root of an interpreter.
+// Paths are routed to the longest matching mount, falling back to the root directory
+// given by [WithPreopenDir] (if any).
+// Aliases mapped by [WithMapDir] and [WithMapFS] are mounted separately and take precedence.
+type mountTable struct {
+	root experimentalsys.FS
+	// persistent mounts, keyed by cleaned alias
+	mounts map[string]experimentalsys.FS
+	// mounts of the query whose wasm call is running
+	scope mountScope
+	mu    sync.RWMutex
+}
+
+func newMountTable(root experimentalsys.FS) *mountTable {
+	if root == nil {
+		// empty directory
+		root = &sysfs.AdaptFS{FS: embed.FS{}}
+	}
+	return &mountTable{
+		root:   root,
+		mounts: make(map[string]experimentalsys.FS),
+	}
+}
+
+// mountKey cleans alias into a path relative to the root.
+func mountKey(alias string) string {
+	key := strings.TrimPrefix(path.Clean("/"+alias), "/")
+	if key == "" {
+		return "."
+	}
+	return key
+}
+
+func (mt *mountTable) mount(alias string, fsys fs.FS) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	mt.mounts[mountKey(alias)] = &sysfs.AdaptFS{FS: fsys}
+}
+
+func (mt *mountTable) unmount(alias string) bool {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	key := mountKey(alias)
+	_, ok := mt.mounts[key]
+	delete(mt.mounts, key)
+	return ok
+}
+
+// inherit copies the persistent mounts of parent.
+func (mt *mountTable) inherit(parent *mountTable) {
+	parent.mu.RLock()
+	defer parent.mu.RUnlock()
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	maps.Copy(mt.mounts, parent.mounts)
+}
+
+// mountScope is the set of query mounts visible to a query, keyed by cleaned alias.
+type mountScope map[string]experimentalsys.FS
+
+// scopeFor returns the scope of a query with the given mounts.
+// Nested queries see the mounts of their callers, whose scope is current while they start.
+func (mt *mountTable) scopeFor(mounts map[string]fs.FS) mountScope {
+	mt.mu.RLock()
+	defer mt.mu.RUnlock()
+	if len(mounts) == 0 {
+		return mt.scope
+	}
+	scope := maps.Clone(mt.scope)
+	if scope == nil {
+		scope = make(mountScope, len(mounts))
+	}
+	for alias, fsys := range mounts {
+		scope[mountKey(alias)] = &sysfs.AdaptFS{FS: fsys}
+	}
+	return scope
+}
+
+// enter makes scope current for the duration of a wasm call, returning a function that restores the previous scope.
+// Queries enter their scope around each call into the interpreter, so that it isn't visible to other queries
+// while they are suspended.
+func (mt *mountTable) enter(scope mountScope) func() {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	prev := mt.scope
+	mt.scope = scope
+	return func() {
+		mt.mu.Lock()
+		mt.scope = prev
+		mt.mu.Unlock()
+	}
+}
+
+// resolve finds the file system responsible for name and the path within it.
+// Query mounts shadow persistent mounts with the same alias.
+func (mt *mountTable) resolve(name string) (experimentalsys.FS, string) {
+	name = mountKey(name)
+	mt.mu.RLock()
+	defer mt.mu.RUnlock()
+	fsys, rel, best := mt.root, name, -1
+	for _, mounts := range []map[string]experimentalsys.FS{mt.mounts, mt.scope} {
+		for key, m := range mounts {
+			var sub string
+			switch {
+			case key == ".":
+				sub = name
+			case name == key:
+				sub = "."
+			case strings.HasPrefix(name, key+"/"):
+				sub = name[len(key)+1:]
+			default:
+				continue
+			}
+			n := len(key)
+			if key == "." {
+				n = 0
+			}
+			if n >= best {
+				fsys, rel, best = m, sub, n
+			}
+		}
+	}
+	return fsys, rel
+}
+
+// resolve2 resolves a pair of paths, which must be on the same file system.
+func (mt *mountTable) resolve2(from, to string) (experimentalsys.FS, string, string, experimentalsys.Errno) {
+	fsys, from := mt.resolve(from)
+	other, to := mt.resolve(to)
+	if fsys != other {
+		return nil, "", "", experimentalsys.ENOTSUP
+	}
+	return fsys, from, to, 0
+}
+
+func (mt *mountTable) OpenFile(path string, flag experimentalsys.Oflag, perm fs.FileMode) (experimentalsys.File, experimentalsys.Errno) {
+	fsys, path := mt.resolve(path)
+	return fsys.OpenFile(path, flag, perm)
+}
+
+func (mt *mountTable) Lstat(path string) (sys.Stat_t, experimentalsys.Errno) {
+	fsys, path := mt.resolve(path)
+	return fsys.Lstat(path)
+}
+
+func (mt *mountTable) Stat(path string) (sys.Stat_t, experimentalsys.Errno) {
+	fsys, path := mt.resolve(path)
+	return fsys.Stat(path)
+}
+
+func (mt *mountTable) Mkdir(path string, perm fs.FileMode) experimentalsys.Errno {
+	fsys, path := mt.resolve(path)
+	return fsys.Mkdir(path, perm)
+}
+
+func (mt *mountTable) Chmod(path string, perm fs.FileMode) experimentalsys.Errno {
+	fsys, path := mt.resolve(path)
+	return fsys.Chmod(path, perm)
+}
+
+func (mt *mountTable) Rename(from, to string) experimentalsys.Errno {
+	fsys, from, to, errno := mt.resolve2(from, to)
+	if errno != 0 {
+		return errno
+	}
+	return fsys.Rename(from, to)
+}
+
+func (mt *mountTable) Rmdir(path string) experimentalsys.Errno {
+	fsys, path := mt.resolve(path)
+	return fsys.Rmdir(path)
+}
+
+func (mt *mountTable) Unlink(path string) experimentalsys.Errno {
+	fsys, path := mt.resolve(path)
+	return fsys.Unlink(path)
+}
+
+func (mt *mountTable) Link(oldPath, newPath string) experimentalsys.Errno {
+	fsys, oldPath, newPath, errno := mt.resolve2(oldPath, newPath)
+	if errno != 0 {
+		return errno
+	}
+	return fsys.Link(oldPath, newPath)
+}
+
+func (mt *mountTable) Symlink(oldPath, linkName string) experimentalsys.Errno {
+	fsys, linkName := mt.resolve(linkName)
+	return fsys.Symlink(oldPath, linkName)
+}
+
+func (mt *mountTable) Readlink(path string) (string, experimentalsys.Errno) {
+	fsys, path := mt.resolve(path)
+	return fsys.Readlink(path)
+}
+
+func (mt *mountTable) Utimens(path string, atim, mtim int64) experimentalsys.Errno {
+	fsys, path := mt.resolve(path)
+	return fsys.Utimens(path, atim, mtim)
+}
+
+func (pl *prolog) Mount(alias string, fsys fs.FS) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.instance == nil {
+		return io.EOF
+	}
+	return pl.mount(alias, fsys)
+}
+
+func (pl *prolog) mount(alias string, fsys fs.FS) error {
+	if fsys == nil {
+		return fmt.Errorf("trealla: nil file system for mount %q", alias)
+	}
+	pl.mounts.mount(alias, fsys)
+	return nil
+}
+
+func (pl *prolog) Unmount(alias string) bool {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.instance == nil {
+		return false
+	}
+	return pl.mounts.unmount(alias)
+}
+
+func (pl *lockedProlog) Mount(alias string, fsys fs.FS) error {
+	if err := pl.ensure(); err != nil {
+		return err
+	}
+	return pl.prolog.mount(alias, fsys)
+}
+
+func (pl *lockedProlog) Unmount(alias string) bool {
+	if err := pl.ensure(); err != nil {
+		return false
+	}
+	return pl.prolog.mounts.unmount(alias)
+}
+
+// WithQueryFS mounts fsys at alias for the duration of the query.
+// The mount is only visible to this query (and queries it runs), shadowing any interpreter mount with the same alias.
+func WithQueryFS(alias string, fsys fs.FS) QueryOption {
+	return func(q *query) {
+		if q.mounts == nil {
+			q.mounts = make(map[string]fs.FS)
+		}
+		q.mounts[alias] = fsys
+	}
+}
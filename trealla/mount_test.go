@@ -0,0 +1,145 @@
+package trealla
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMount(t *testing.T) {
+	ctx := context.Background()
+	pl, err := New(WithMapDir("/foo", "testdata/subdirectory"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Close()
+	registerNap(t, pl)
+
+	err = pl.ConsultText(ctx, "user", `read_file(File, T) :- open(File, read, S), read_term(S, T, []), close(S).`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readFile := func(t *testing.T, pl Prolog, file string, options ...QueryOption) (Term, error) {
+		t.Helper()
+		ans, err := pl.QueryOnce(ctx, `read_file(File, T).`, append(options, WithBind("File", Atom(file)))...)
+		if err != nil {
+			return nil, err
+		}
+		return ans.Solution["T"], nil
+	}
+
+	uploads := fstest.MapFS{
+		"a.pl":     {Data: []byte("hello(world).\n")},
+		"sub/b.pl": {Data: []byte("deep.\n")},
+	}
+	if err := pl.Mount("/uploads", uploads); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("mounted", func(t *testing.T) {
+		got, err := readFile(t, pl, "/uploads/a.pl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := Atom("hello").Of(Atom("world")); !reflect.DeepEqual(got, want) {
+			t.Error("want:", want, "got:", got)
+		}
+		got, err = readFile(t, pl, "/uploads/sub/b.pl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != Atom("deep") {
+			t.Error("want: deep got:", got)
+		}
+		if _, err := pl.QueryOnce(ctx, `exists_directory('/uploads/sub').`); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("static mounts still work", func(t *testing.T) {
+		if _, err := pl.QueryOnce(ctx, `exists_file('/foo/foo.txt').`); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("clones inherit", func(t *testing.T) {
+		clone, err := pl.Clone()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer clone.Close()
+		if _, err := readFile(t, clone, "/uploads/a.pl"); err != nil {
+			t.Fatal(err)
+		}
+		// unmounting in the clone doesn't affect the parent
+		if !clone.Unmount("/uploads") {
+			t.Error("expected mount to exist")
+		}
+		if _, err := readFile(t, pl, "/uploads/a.pl"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("query mounts", func(t *testing.T) {
+		private := fstest.MapFS{
+			"secret.pl": {Data: []byte("secret(42).\n")},
+		}
+		got, err := readFile(t, pl, "/private/secret.pl", WithQueryFS("/private", private))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := Atom("secret").Of(int64(42)); !reflect.DeepEqual(got, want) {
+			t.Error("want:", want, "got:", got)
+		}
+		if _, err := readFile(t, pl, "/private/secret.pl"); err == nil {
+			t.Error("query mount leaked")
+		}
+
+		// shadows the interpreter's mount
+		shadow := fstest.MapFS{
+			"a.pl": {Data: []byte("shadowed.\n")},
+		}
+		got, err = readFile(t, pl, "/uploads/a.pl", WithQueryFS("/uploads", shadow))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != Atom("shadowed") {
+			t.Error("want: shadowed got:", got)
+		}
+	})
+
+	t.Run("query mounts of suspended queries", func(t *testing.T) {
+		private := fstest.MapFS{
+			"secret.pl": {Data: []byte("secret(42).\n")},
+		}
+		done := make(chan error, 1)
+		go func() {
+			// yields to the host, letting other queries run in the meantime
+			q := pl.Query(ctx, `nap(0.2), read_file('/private/secret.pl', _).`, WithQueryFS("/private", private))
+			defer q.Close()
+			q.Next(ctx)
+			done <- q.Err()
+		}()
+		time.Sleep(50 * time.Millisecond)
+		if _, err := readFile(t, pl, "/private/secret.pl"); err == nil {
+			t.Error("query mount leaked to another query")
+		}
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("unmount", func(t *testing.T) {
+		if !pl.Unmount("/uploads/") {
+			t.Error("expected mount to exist")
+		}
+		if pl.Unmount("/uploads") {
+			t.Error("expected mount to be gone")
+		}
+		if _, err := readFile(t, pl, "/uploads/a.pl"); err == nil {
+			t.Error("expected error after unmount")
+		}
+	})
+}
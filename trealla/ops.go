@@ -0,0 +1,337 @@
+package trealla
+
+import (
+	"cmp"
+	"context"
+	"io"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Operator is an operator definition, as in op/3.
+type Operator struct {
+	Priority int
+	// Specifier is the type of operator: one of xfx, xfy, yfx, fy, fx, xf, or yf.
+	Specifier Atom
+	Name      Atom
+}
+
+func (op Operator) prefix() bool {
+	return op.Specifier == "fy" || op.Specifier == "fx"
+}
+
+func (op Operator) infix() bool {
+	return op.Specifier == "xfx" || op.Specifier == "xfy" || op.Specifier == "yfx"
+}
+
+func (op Operator) postfix() bool {
+	return op.Specifier == "xf" || op.Specifier == "yf"
+}
+
+// Operators is a table of operators, as returned by [Prolog.CurrentOps].
+type Operators []Operator
+
+// Marshal returns the Prolog text representation of term like [Marshal],
+// but writes compounds whose functors are operators in operator notation,
+// so that the text can be read back by an interpreter with the same operators.
+func (ops Operators) Marshal(term Term, options ...MarshalOption) (string, error) {
+	return marshalWith(term, ops.table(), options)
+}
+
+// with returns a copy of ops with op defined as by op/3,
+// replacing the operator of the same name and kind (prefix, infix or postfix).
+// A priority of 0 removes it.
+func (ops Operators) with(op Operator) Operators {
+	kind := func(o Operator) int {
+		switch {
+		case o.prefix():
+			return 1
+		case o.infix():
+			return 2
+		}
+		return 3
+	}
+	ops = slices.DeleteFunc(slices.Clone(ops), func(other Operator) bool {
+		return other.Name == op.Name && kind(other) == kind(op)
+	})
+	if op.Priority > 0 {
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// opTable indexes operators for writing.
+type opTable struct {
+	prefix  map[Atom]Operator
+	infix   map[Atom]Operator
+	postfix map[Atom]Operator
+	// highest priority of each operator
+	atoms map[Atom]int
+}
+
+func (ops Operators) table() *opTable {
+	t := &opTable{
+		prefix:  make(map[Atom]Operator),
+		infix:   make(map[Atom]Operator),
+		postfix: make(map[Atom]Operator),
+		atoms:   make(map[Atom]int),
+	}
+	for _, op := range ops {
+		switch {
+		case op.prefix():
+			t.prefix[op.Name] = op
+		case op.infix():
+			t.infix[op.Name] = op
+		case op.postfix():
+			t.postfix[op.Name] = op
+		default:
+			continue
+		}
+		t.atoms[op.Name] = max(t.atoms[op.Name], op.Priority)
+	}
+	return t
+}
+
+// find returns the operator to write c with, if any.
+func (t *opTable) find(c Compound) (Operator, bool) {
+	switch len(c.Args) {
+	case 1:
+		if op, ok := t.prefix[c.Functor]; ok {
+			// -(1) is not the same as -1
+			if !isNumber(c.Args[0]) || (c.Functor != "-" && c.Functor != "+") {
+				return op, true
+			}
+		}
+		op, ok := t.postfix[c.Functor]
+		return op, ok
+	case 2:
+		op, ok := t.infix[c.Functor]
+		return op, ok
+	}
+	return Operator{}, false
+}
+
+// operation writes c in operator notation.
+func (e *encoder) operation(c Compound, op Operator, prec int) error {
+	open := op.Priority > prec
+	if open {
+		e.WriteByte('(')
+	}
+	// x arguments must have a lower priority than the operator, y arguments can be equal
+	left, right := op.Priority-1, op.Priority-1
+	switch op.Specifier {
+	case "fy", "xfy":
+		right = op.Priority
+	case "yf", "yfx":
+		left = op.Priority
+	}
+	var err error
+	switch {
+	case op.prefix():
+		e.WriteString(atomText(c.Functor) + " ")
+		err = e.arg(c.Args[0], right)
+	case op.postfix():
+		if err = e.arg(c.Args[0], left); err == nil {
+			e.WriteString(" " + atomText(c.Functor))
+		}
+	default:
+		if err = e.arg(c.Args[0], left); err != nil {
+			break
+		}
+		if c.Functor == "," {
+			e.WriteString(", ")
+		} else {
+			e.WriteString(" " + atomText(c.Functor) + " ")
+		}
+		err = e.arg(c.Args[1], right)
+	}
+	if open {
+		e.WriteByte(')')
+	}
+	return err
+}
+
+// atomText is like [Atom.String], but leaves atoms made of symbol characters (like ===>) unquoted.
+func atomText(a Atom) string {
+	if a == "" || a == "." || strings.HasPrefix(string(a), "/*") || strings.Trim(string(a), symbolChars) != "" {
+		return a.String()
+	}
+	return string(a)
+}
+
+const symbolChars = `+-*/\^<>=~:.?@#&$`
+
+func isNumber(t Term) bool {
+	switch t.(type) {
+	case int64, int, uint64, uint, float64, float32, *big.Int:
+		return true
+	}
+	return false
+}
+
+func (pl *prolog) Marshal(term Term, options ...MarshalOption) (string, error) {
+	pl.mu.Lock()
+	ops := pl.ops
+	pl.mu.Unlock()
+	return marshalWith(term, ops, options)
+}
+
+// setOperators replaces the operators that this interpreter writes in operator notation.
+func (pl *prolog) setOperators(ops Operators) {
+	pl.operators = ops
+	pl.ops = nil
+	if len(ops) > 0 {
+		pl.ops = ops.table()
+	}
+}
+
+func (pl *prolog) CurrentOps(ctx context.Context) (Operators, error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.instance == nil {
+		return nil, io.EOF
+	}
+	return pl.currentOperators(ctx)
+}
+
+// currentOperators lists the operators, sorted by name and specifier.
+// The interpreter's own table is brought up to date along the way.
+func (pl *prolog) currentOperators(ctx context.Context) (Operators, error) {
+	current, err := pl.currentOps(ctx)
+	if err != nil {
+		return nil, err
+	}
+	base, err := loadBaseline(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ops := make(Operators, 0, len(current))
+	var custom Operators
+	for key, t := range current {
+		op, ok := operator(t)
+		if !ok {
+			continue
+		}
+		ops = append(ops, op)
+		if prev, ok := base.ops[key]; !ok || !reflect.DeepEqual(prev, t) {
+			custom = append(custom, op)
+		}
+	}
+	sortOperators(ops)
+	sortOperators(custom)
+	pl.setOperators(custom)
+	return ops, nil
+}
+
+// refreshOperators rereads the operators after text that might define some was loaded.
+func (pl *prolog) refreshOperators(ctx context.Context) error {
+	_, err := pl.currentOperators(ctx)
+	return err
+}
+
+// operator converts an op/3 term.
+func operator(t Term) (Operator, bool) {
+	op, ok := t.(Compound)
+	if !ok || len(op.Args) != 3 {
+		return Operator{}, false
+	}
+	priority, _ := op.Args[0].(int64)
+	spec, _ := op.Args[1].(Atom)
+	name, ok := op.Args[2].(Atom)
+	if !ok {
+		return Operator{}, false
+	}
+	return Operator{Priority: int(priority), Specifier: spec, Name: name}, true
+}
+
+func sortOperators(ops Operators) {
+	slices.SortFunc(ops, func(a, b Operator) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.Specifier, b.Specifier))
+	})
+}
+
+func (pl *prolog) Op(ctx context.Context, priority int, specifier Atom, name Atom) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.instance == nil {
+		return io.EOF
+	}
+	return pl.op(ctx, priority, specifier, name)
+}
+
+func (pl *prolog) op(ctx context.Context, priority int, specifier Atom, name Atom) error {
+	_, err := pl.queryOnce(ctx, "op(P, T, N).", withKnownOps, WithBind("P", int64(priority)), WithBind("T", specifier), WithBind("N", name))
+	if err != nil {
+		return err
+	}
+	pl.setOperators(pl.operators.with(Operator{Priority: priority, Specifier: specifier, Name: name}))
+	return nil
+}
+
+func (pl *prolog) GetFlag(ctx context.Context, name Atom) (Term, error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.instance == nil {
+		return nil, io.EOF
+	}
+	return pl.getFlag(ctx, name)
+}
+
+func (pl *prolog) getFlag(ctx context.Context, name Atom) (Term, error) {
+	ans, err := pl.queryOnce(ctx, "current_prolog_flag(Name, Value).", WithBind("Name", name))
+	if err != nil {
+		return nil, err
+	}
+	return ans.Solution["Value"], nil
+}
+
+func (pl *prolog) SetFlag(ctx context.Context, name Atom, value Term) error {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.instance == nil {
+		return io.EOF
+	}
+	return pl.setFlag(ctx, name, value)
+}
+
+func (pl *prolog) setFlag(ctx context.Context, name Atom, value Term) error {
+	_, err := pl.queryOnce(ctx, "set_prolog_flag(Name, Value).", WithBind("Name", name), WithBind("Value", value))
+	return err
+}
+
+func (pl *lockedProlog) Marshal(term Term, options ...MarshalOption) (string, error) {
+	if err := pl.ensure(); err != nil {
+		return "", err
+	}
+	return marshalWith(term, pl.prolog.ops, options)
+}
+
+func (pl *lockedProlog) CurrentOps(ctx context.Context) (Operators, error) {
+	if err := pl.ensure(); err != nil {
+		return nil, err
+	}
+	return pl.prolog.currentOperators(ctx)
+}
+
+func (pl *lockedProlog) Op(ctx context.Context, priority int, specifier Atom, name Atom) error {
+	if err := pl.ensure(); err != nil {
+		return err
+	}
+	return pl.prolog.op(ctx, priority, specifier, name)
+}
+
+func (pl *lockedProlog) GetFlag(ctx context.Context, name Atom) (Term, error) {
+	if err := pl.ensure(); err != nil {
+		return nil, err
+	}
+	return pl.prolog.getFlag(ctx, name)
+}
+
+func (pl *lockedProlog) SetFlag(ctx context.Context, name Atom, value Term) error {
+	if err := pl.ensure(); err != nil {
+		return err
+	}
+	return pl.prolog.setFlag(ctx, name, value)
+}
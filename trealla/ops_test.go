@@ -0,0 +1,149 @@
+package trealla
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestFlags(t *testing.T) {
+	ctx := context.Background()
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Close()
+
+	if err := pl.SetFlag(ctx, "double_quotes", Atom("atom")); err != nil {
+		t.Fatal(err)
+	}
+	got, err := pl.GetFlag(ctx, "double_quotes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != Atom("atom") {
+		t.Error("want: atom got:", got)
+	}
+	ans, err := pl.QueryOnce(ctx, `X = "abc".`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := ans.Solution["X"]; x != Atom("abc") {
+		t.Error("flag not applied, got:", x)
+	}
+
+	var ex ErrThrow
+	if _, err := pl.GetFlag(ctx, "no_such_flag"); !errors.As(err, &ex) {
+		t.Error("expected exception, got:", err)
+	}
+	if err := pl.SetFlag(ctx, "no_such_flag", int64(1)); !errors.As(err, &ex) {
+		t.Error("expected exception, got:", err)
+	}
+}
+
+func TestOps(t *testing.T) {
+	ctx := context.Background()
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Close()
+
+	if err := pl.Op(ctx, 700, "xfx", "===>"); err != nil {
+		t.Fatal(err)
+	}
+	var ex ErrThrow
+	if err := pl.Op(ctx, 1201, "xfx", "bad"); !errors.As(err, &ex) {
+		t.Error("expected exception, got:", err)
+	}
+
+	ops, err := pl.CurrentOps(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Contains(ops, Operator{Priority: 700, Specifier: "xfx", Name: "===>"}) {
+		t.Error("missing operator:", ops)
+	}
+
+	t.Run("Marshal", func(t *testing.T) {
+		tests := []struct {
+			term Term
+			want string
+		}{
+			{Atom("===>").Of(Atom("a"), Atom("b")), "a ===> b"},
+			{Atom("===>").Of(Atom("a"), Atom("+").Of(int64(1), int64(2))), "a ===> 1 + 2"},
+			{Atom("-").Of(int64(1), Atom("-").Of(int64(2), int64(3))), "1 - (2 - 3)"},
+			{Atom("-").Of(Atom("-").Of(int64(1), int64(2)), int64(3)), "1 - 2 - 3"},
+			{Atom("-").Of(int64(1)), "-(1)"},
+			{Atom("-").Of(Atom("-").Of(Atom("a"))), "- - a"},
+			{Atom("\\+").Of(Atom("a")), "\\+ a"},
+			{Atom(":-").Of(Atom("a"), Atom(",").Of(Atom("b"), Atom("c"))), "a :- b, c"},
+			{Atom("f").Of(Atom(",").Of(Atom("a"), Atom("b"))), "f((a, b))"},
+			{Atom("=").Of(Atom("a"), Atom("\\+")), "a = (\\+)"},
+			{Atom("{}").Of(Atom(",").Of(Atom("a"), Atom("b"))), "{a, b}"},
+			{[]Term{Atom("===>").Of(Atom("x"), Atom("y")), "str"}, `[x ===> y, "str"]`},
+		}
+		for _, tc := range tests {
+			got, err := ops.Marshal(tc.term)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("want: %s got: %s", tc.want, got)
+			}
+			// must read back as the same term
+			if _, err := pl.QueryOnce(ctx, "X = ("+got+"), Y == X.", WithBind("Y", tc.term)); err != nil {
+				t.Errorf("%s: %v", got, err)
+			}
+		}
+	})
+
+	t.Run("interpreter Marshal", func(t *testing.T) {
+		term := Atom("===>").Of(Atom("a"), Atom("+").Of(int64(1), int64(2)))
+		got, err := pl.Marshal(term)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "a ===> +(1, 2)"; got != want {
+			t.Errorf("want: %s got: %s", want, got)
+		}
+		// bindings are written the same way
+		if _, err := pl.QueryOnce(ctx, "X = (a ===> 1 + 2), X == Y.", WithBind("Y", term)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("op/3", func(t *testing.T) {
+		if _, err := pl.QueryOnce(ctx, `op(200, xfy, ~>).`); err != nil {
+			t.Fatal(err)
+		}
+		got, err := pl.Marshal(Atom("~>").Of(Atom("a"), Atom("~>").Of(Atom("b"), Atom("c"))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "a ~> b ~> c"; got != want {
+			t.Errorf("want: %s got: %s", want, got)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if err := pl.Op(ctx, 0, "xfx", "===>"); err != nil {
+			t.Fatal(err)
+		}
+		got, err := pl.Marshal(Atom("===>").Of(Atom("a"), Atom("b")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "===>(a, b)"; got != want {
+			t.Errorf("want: %s got: %s", want, got)
+		}
+		ops, err := pl.CurrentOps(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slices.ContainsFunc(ops, func(op Operator) bool { return op.Name == "===>" }) {
+			t.Error("operator not removed:", ops)
+		}
+	})
+}
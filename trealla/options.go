@@ -0,0 +1,204 @@
+package trealla
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// OptionError is returned by [DecodeOptions] for an invalid options list.
+type OptionError struct {
+	// Formal is the ISO error term, such as domain_error(option, foo(1)).
+	Formal Term
+}
+
+// Error implements the error interface.
+func (err OptionError) Error() string {
+	return fmt.Sprintf("trealla: invalid options: %v", err.Formal)
+}
+
+// Throw returns a term that throws error(Formal, Context), suitable for returning from a [Predicate].
+func (err OptionError) Throw(context Term) Compound {
+	return throwTerm(Atom("error").Of(err.Formal, context))
+}
+
+// DecodeOptions fills the struct pointed to by dst from an options list like [name(Value), ...], as seen in open/4.
+// Options are matched to fields by their prolog tag, or by their name in snake_case.
+// Fields for options that aren't present are left unchanged, so set them to their defaults beforehand.
+// If an option appears more than once, the first one wins.
+//
+// Errors follow open/4 and are returned as [OptionError]:
+//   - instantiation_error if the list is partial or contains variables
+//   - type_error(list, Opts) if opts isn't a list
+//   - domain_error(option, Option) for unknown options, or options that aren't compounds of one argument
+//   - type_error(Type, Value) for values of the wrong type, where Type is
+//     atom, chars, boolean, integer, or number depending on the field
+func DecodeOptions(opts Term, dst any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("trealla: must pass pointer to struct for DecodeOptions. got: %T", dst)
+	}
+	rv = rv.Elem()
+
+	var list []Term
+	switch x := opts.(type) {
+	case []Term:
+		list = x
+	case Atom:
+		if x != "[]" {
+			return OptionError{Formal: Atom("type_error").Of(Atom("list"), opts)}
+		}
+	case Variable:
+		return OptionError{Formal: Atom("instantiation_error")}
+	case Compound:
+		if x.Functor == "." && len(x.Args) == 2 {
+			// partial list
+			return OptionError{Formal: Atom("instantiation_error")}
+		}
+		return OptionError{Formal: Atom("type_error").Of(Atom("list"), opts)}
+	default:
+		return OptionError{Formal: Atom("type_error").Of(Atom("list"), opts)}
+	}
+
+	fields := optionFields(rv)
+	seen := make(map[Atom]bool, len(list))
+	for _, opt := range list {
+		var option Compound
+		switch x := opt.(type) {
+		case Variable:
+			return OptionError{Formal: Atom("instantiation_error")}
+		case Compound:
+			option = x
+		default:
+			return OptionError{Formal: Atom("domain_error").Of(Atom("option"), opt)}
+		}
+		field, ok := fields[option.Functor]
+		if !ok || len(option.Args) != 1 {
+			return OptionError{Formal: Atom("domain_error").Of(Atom("option"), opt)}
+		}
+		if seen[option.Functor] {
+			// later duplicates are checked but ignored
+			field = reflect.New(field.Type()).Elem()
+		}
+		seen[option.Functor] = true
+		if err := setOption(field, option); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// optionFields returns the settable fields of rv by option name.
+func optionFields(rv reflect.Value) map[Atom]reflect.Value {
+	fields := make(map[Atom]reflect.Value)
+	for _, field := range plainFields(rv) {
+		if !field.value.CanSet() {
+			continue
+		}
+		name := field.name
+		if field.info.Tag.Get("prolog") == "" {
+			name = snakeCase(name)
+		}
+		fields[Atom(name)] = field.value
+	}
+	return fields
+}
+
+// setOption sets fv to the argument of option, checking its type.
+func setOption(fv reflect.Value, option Compound) error {
+	arg := option.Args[0]
+	if _, ok := arg.(Variable); ok {
+		return OptionError{Formal: Atom("instantiation_error")}
+	}
+	typeError := func(want Atom) error {
+		return OptionError{Formal: Atom("type_error").Of(want, arg)}
+	}
+
+	ftype := fv.Type()
+	switch {
+	case ftype == termType || ftype == anyType:
+		fv.Set(reflect.ValueOf(&arg).Elem())
+		return nil
+	case ftype == charsType || ftype == codesType:
+		text, ok := Text(arg)
+		if !ok {
+			return typeError("chars")
+		}
+		fv.SetString(text)
+		return nil
+	case ftype.ConvertibleTo(atomType) && ftype.Kind() == reflect.String && ftype != reflect.TypeFor[string]():
+		a, ok := arg.(Atom)
+		if !ok {
+			return typeError("atom")
+		}
+		fv.SetString(string(a))
+		return nil
+	}
+
+	switch ftype.Kind() {
+	case reflect.String:
+		switch x := arg.(type) {
+		case string:
+			fv.SetString(x)
+		case Atom:
+			if x != "[]" {
+				return typeError("chars")
+			}
+			fv.SetString("")
+		default:
+			return typeError("chars")
+		}
+	case reflect.Bool:
+		switch arg {
+		case Atom("true"):
+			fv.SetBool(true)
+		case Atom("false"):
+			fv.SetBool(false)
+		default:
+			return typeError("boolean")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := arg.(int64)
+		if !ok {
+			return typeError("integer")
+		}
+		if fv.OverflowInt(n) {
+			return OptionError{Formal: Atom("representation_error").Of(Atom("max_integer"))}
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := arg.(int64)
+		if !ok {
+			return typeError("integer")
+		}
+		if n < 0 {
+			return OptionError{Formal: Atom("domain_error").Of(Atom("not_less_than_zero"), arg)}
+		}
+		if fv.OverflowUint(uint64(n)) {
+			return OptionError{Formal: Atom("representation_error").Of(Atom("max_integer"))}
+		}
+		fv.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch x := arg.(type) {
+		case float64:
+			f = x
+		case int64:
+			f = float64(x)
+		case *big.Int:
+			f, _ = new(big.Float).SetInt(x).Float64()
+		default:
+			return typeError("number")
+		}
+		if ftype.Kind() == reflect.Float32 && math.Abs(f) > math.MaxFloat32 {
+			return OptionError{Formal: Atom("representation_error").Of(Atom("max_float"))}
+		}
+		fv.SetFloat(f)
+	default:
+		if err := convert(fv, reflect.ValueOf(arg), reflect.StructField{}); err != nil {
+			return OptionError{Formal: Atom("domain_error").Of(Atom("option"), option)}
+		}
+	}
+	return nil
+}
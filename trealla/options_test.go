@@ -0,0 +1,90 @@
+package trealla
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeOptions(t *testing.T) {
+	type options struct {
+		Mode       Atom
+		Alias      Term `prolog:"alias"`
+		EOFCode    int  `prolog:"eof_code"`
+		Reposition bool
+		Encoding   string
+		Timeout    float64
+		Codes      Codes
+	}
+	list := []Term{
+		Atom("mode").Of(Atom("read")),
+		Atom("alias").Of(Atom("in")),
+		Atom("eof_code").Of(int64(-1)),
+		Atom("reposition").Of(Atom("true")),
+		Atom("encoding").Of("utf8"),
+		Atom("timeout").Of(int64(3)),
+		Atom("codes").Of([]Term{int64(104), int64(105)}),
+		Atom("mode").Of(Atom("write")),
+	}
+	got := options{Mode: "append", Encoding: "none"}
+	if err := DecodeOptions(list, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := options{Mode: "read", Alias: Atom("in"), EOFCode: -1, Reposition: true, Encoding: "utf8", Timeout: 3, Codes: "hi"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want: %+v got: %+v", want, got)
+	}
+
+	defaults := options{Mode: "append"}
+	if err := DecodeOptions(Atom("[]"), &defaults); err != nil || defaults.Mode != "append" {
+		t.Error("empty list changed defaults:", defaults, err)
+	}
+
+	tests := []struct {
+		opts Term
+		want Term
+	}{
+		{Variable{Name: "X"}, Atom("instantiation_error")},
+		{Atom("foo"), Atom("type_error").Of(Atom("list"), Atom("foo"))},
+		{[]Term{Variable{Name: "X"}}, Atom("instantiation_error")},
+		{[]Term{Atom("mode").Of(Variable{Name: "X"})}, Atom("instantiation_error")},
+		{[]Term{Atom("nope").Of(int64(1))}, Atom("domain_error").Of(Atom("option"), Atom("nope").Of(int64(1)))},
+		{[]Term{Atom("mode")}, Atom("domain_error").Of(Atom("option"), Atom("mode"))},
+		{[]Term{Atom("mode").Of(Atom("a"), Atom("b"))}, Atom("domain_error").Of(Atom("option"), Atom("mode").Of(Atom("a"), Atom("b")))},
+		{[]Term{Atom("mode").Of("read")}, Atom("type_error").Of(Atom("atom"), "read")},
+		{[]Term{Atom("eof_code").Of(1.5)}, Atom("type_error").Of(Atom("integer"), 1.5)},
+		{[]Term{Atom("reposition").Of(Atom("yes"))}, Atom("type_error").Of(Atom("boolean"), Atom("yes"))},
+		{[]Term{Atom("encoding").Of(Atom("utf8"))}, Atom("type_error").Of(Atom("chars"), Atom("utf8"))},
+		{[]Term{Atom("timeout").Of(Atom("inf"))}, Atom("type_error").Of(Atom("number"), Atom("inf"))},
+		{[]Term{Atom("mode").Of(Atom("read")), Atom("mode").Of(int64(1))}, Atom("type_error").Of(Atom("atom"), int64(1))},
+	}
+	for _, tc := range tests {
+		var opts options
+		err := DecodeOptions(tc.opts, &opts)
+		var optErr OptionError
+		if !errors.As(err, &optErr) {
+			t.Errorf("%v: want OptionError, got: %v", tc.opts, err)
+			continue
+		}
+		if !reflect.DeepEqual(optErr.Formal, tc.want) {
+			t.Errorf("%v: want: %v got: %v", tc.opts, tc.want, optErr.Formal)
+		}
+	}
+
+	t.Run("http_fetch/3", func(t *testing.T) {
+		pl, err := New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pl.Close()
+		ans, err := pl.QueryOnce(context.Background(),
+			`catch(http_fetch("http://example.invalid", _, [bogus(1)]), error(E, _), true).`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := Atom("domain_error").Of(Atom("option"), Atom("bogus").Of(int64(1))); !reflect.DeepEqual(ans.Solution["E"], want) {
+			t.Error("want:", want, "got:", ans.Solution["E"])
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package trealla
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"sync"
@@ -13,11 +14,42 @@ type Pool struct {
 	idle     chan *prolog
 	mu       *sync.RWMutex
 
+	// gen is the generation of canon, incremented by each write
+	gen uint64
+	// synced is the generation each replica was last updated to
+	synced map[*prolog]uint64
+	syncMu sync.Mutex
+
+	// writes waiting to be committed by Write, and whether a group is being committed
+	writes  []*writeRequest
+	writing bool
+	writeMu sync.Mutex
+
+	// cursors and the replicas they hold
+	cursors *cursorRegistry
+	held    map[*prolog]struct{}
+	heldMu  sync.Mutex
+
 	// options
 	size int
 	cfg  []Option
+	sync PoolSync
 }
 
+// PoolSync is a strategy for updating the replicas of a [Pool] after a write.
+type PoolSync int
+
+const (
+	// PoolSyncEager updates every idle replica before [Pool.WriteTx] returns, blocking readers meanwhile.
+	// This is the default.
+	PoolSyncEager PoolSync = iota
+	// PoolSyncLazy updates replicas when they are next checked out by a reader.
+	PoolSyncLazy
+	// PoolSyncBackground updates idle replicas in the background after [Pool.WriteTx] returns.
+	// Replicas that were missed are updated when they are next checked out.
+	PoolSyncBackground
+)
+
 // NewPool creates a new pool with the given options.
 // By default, the pool size will match the number of available CPUs.
 func NewPool(options ...PoolOption) (*Pool, error) {
@@ -35,6 +67,14 @@ func NewPool(options ...PoolOption) (*Pool, error) {
 		return nil, err
 	}
 	pool.canon = pl.(*prolog)
+	// leave a replica for readers, so a pool of one can't have any cursors
+	spare := pool.size - 1
+	if spare == 0 {
+		spare = -1
+	}
+	pool.cursors = newCursorRegistry(pool.canon.cursorTTL, pool.canon.cursorLimit, spare)
+	pool.synced = make(map[*prolog]uint64)
+	pool.held = make(map[*prolog]struct{})
 	pool.children = make([]*prolog, pool.size)
 	pool.idle = make(chan *prolog, pool.size)
 	for i := range pool.children {
@@ -43,6 +83,7 @@ func NewPool(options ...PoolOption) (*Pool, error) {
 		if err != nil {
 			return nil, err
 		}
+		pool.children[i].pool = pool
 		pool.idle <- pool.children[i]
 	}
 	return pool, nil
@@ -50,38 +91,81 @@ func NewPool(options ...PoolOption) (*Pool, error) {
 
 // WriteTx executes a write transaction against this Pool.
 // Use this when modifying the knowledgebase (assert/retract, consulting files, loading modules, and so on).
-func (pool *Pool) WriteTx(tx func(Prolog) error) error {
+func (pool *Pool) WriteTx(tx func(Prolog) error, options ...TxOption) error {
+	var cfg txConfig
+	for _, opt := range options {
+		opt(&cfg)
+	}
+
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
-	pl := &lockedProlog{prolog: pool.canon}
-	defer pl.kill()
+
+	target := pool.canon
+	if cfg.dryRun {
+		var err error
+		target, err = pool.canon.clone()
+		if err != nil {
+			return err
+		}
+		defer target.Close()
+	}
+
+	var before kbSnapshot
+	if cfg.diff != nil {
+		var err error
+		if before, err = target.snapshot(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	pl := &lockedProlog{prolog: target}
 	err := tx(pl)
+	pl.kill()
 
-	// Eagerly update the replicas.
-	// This seems to be faster than lazily updating them.
-	if err == nil {
-		for _, child := range pool.children {
-			if err := child.become(pool.canon); err != nil {
-				return err
-			}
+	if err == nil && cfg.diff != nil {
+		after, err := target.snapshot(context.Background())
+		if err != nil {
+			return err
 		}
+		*cfg.diff = before.diff(after)
+	}
+
+	if err == nil && !cfg.dryRun {
+		return pool.commit()
 	}
 
 	return err
 }
 
+// commit bumps the generation of canon after a write, updating replicas according to the sync mode.
+// The caller must hold pool.mu for writing.
+func (pool *Pool) commit() error {
+	pool.gen++
+	switch pool.sync {
+	case PoolSyncEager:
+		return pool.refreshAll()
+	case PoolSyncBackground:
+		// waits for the write lock to be released
+		go pool.refreshIdle()
+	}
+	return nil
+}
+
 // ReadTx executes a read transaction against this Pool.
 // Queries in a read transaction must not modify the knowledgebase.
 func (pool *Pool) ReadTx(tx func(Prolog) error) error {
 	pool.mu.RLock()
 	defer pool.mu.RUnlock()
-	child := pool.child()
+	child, err := pool.checkout()
+	if err != nil {
+		return err
+	}
 	defer pool.done(child)
 	child.mu.Lock()
 	defer child.mu.Unlock()
 	pl := &lockedProlog{prolog: child}
 	defer pl.kill()
-	err := tx(pl)
+	err = tx(pl)
 	return err
 }
 
@@ -101,10 +185,124 @@ func (pool *Pool) child() *prolog {
 	return <-pool.idle
 }
 
+// checkout takes an idle replica, bringing it up to date.
+func (pool *Pool) checkout() (*prolog, error) {
+	child := pool.child()
+	if err := pool.refresh(child); err != nil {
+		pool.done(child)
+		return nil, err
+	}
+	return child, nil
+}
+
 func (pool *Pool) done(child *prolog) {
 	pool.idle <- child
 }
 
+// refresh updates a replica to the current generation of canon if it's behind.
+// The caller must hold pool.mu and have exclusive use of child.
+func (pool *Pool) refresh(child *prolog) error {
+	pool.syncMu.Lock()
+	gen := pool.synced[child]
+	pool.syncMu.Unlock()
+	if gen == pool.gen {
+		return nil
+	}
+
+	child.mu.Lock()
+	err := child.become(pool.canon)
+	child.setOperators(pool.canon.operators)
+	child.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	pool.syncMu.Lock()
+	pool.synced[child] = pool.gen
+	pool.syncMu.Unlock()
+	return nil
+}
+
+// borrow takes up to n idle replicas that are at the same generation as caller, without waiting.
+// They are marked as held so writes don't update them in the meantime.
+func (pool *Pool) borrow(caller *prolog, n int) []*prolog {
+	pool.syncMu.Lock()
+	gen := pool.synced[caller]
+	pool.syncMu.Unlock()
+
+	var borrowed, stale []*prolog
+	defer func() {
+		for _, child := range stale {
+			pool.done(child)
+		}
+	}()
+	for len(borrowed) < n {
+		select {
+		case child := <-pool.idle:
+			pool.syncMu.Lock()
+			current := pool.synced[child] == gen
+			pool.syncMu.Unlock()
+			if !current {
+				stale = append(stale, child)
+				continue
+			}
+			pool.hold(child)
+			borrowed = append(borrowed, child)
+		default:
+			return borrowed
+		}
+	}
+	return borrowed
+}
+
+// giveBack returns borrowed replicas.
+// Replicas that missed a write are updated when they are next checked out.
+func (pool *Pool) giveBack(replicas []*prolog) {
+	pool.heldMu.Lock()
+	for _, child := range replicas {
+		delete(pool.held, child)
+	}
+	pool.heldMu.Unlock()
+	for _, child := range replicas {
+		pool.done(child)
+	}
+}
+
+// refreshAll updates every replica that isn't held by a cursor.
+// The caller must hold pool.mu for writing.
+func (pool *Pool) refreshAll() error {
+	pool.heldMu.Lock()
+	defer pool.heldMu.Unlock()
+	for _, child := range pool.children {
+		// replicas used by cursors catch up when released
+		if _, ok := pool.held[child]; ok {
+			continue
+		}
+		if err := pool.refresh(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refreshIdle updates idle replicas, one at a time so readers can use the others meanwhile.
+func (pool *Pool) refreshIdle() {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+	for range pool.size {
+		select {
+		case child := <-pool.idle:
+			err := pool.refresh(child)
+			pool.done(child)
+			if err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
 // PoolOption is an option for configuring a Pool.
 type PoolOption func(*Pool) error
 
@@ -126,3 +324,35 @@ func WithPoolPrologOption(options ...Option) PoolOption {
 		return nil
 	}
 }
+
+// TxOption is an optional parameter for [Pool.WriteTx].
+type TxOption func(*txConfig)
+
+type txConfig struct {
+	diff   *KBDiff
+	dryRun bool
+}
+
+// WithTxDiff reports the changes made by a successful transaction to diff.
+// Comparing the knowledgebase makes transactions considerably slower.
+func WithTxDiff(diff *KBDiff) TxOption {
+	return func(cfg *txConfig) {
+		cfg.diff = diff
+	}
+}
+
+// WithTxDryRun runs a transaction against a copy of the knowledgebase which is then discarded.
+// Use it with [WithTxDiff] to preview changes.
+func WithTxDryRun() TxOption {
+	return func(cfg *txConfig) {
+		cfg.dryRun = true
+	}
+}
+
+// WithPoolSync sets how replicas are updated after a write. The default is [PoolSyncEager].
+func WithPoolSync(mode PoolSync) PoolOption {
+	return func(pool *Pool) error {
+		pool.sync = mode
+		return nil
+	}
+}
@@ -40,6 +40,107 @@ func TestPool(t *testing.T) {
 	wg.Wait()
 }
 
+func TestPoolSync(t *testing.T) {
+	ctx := context.Background()
+	for _, mode := range []PoolSync{PoolSyncEager, PoolSyncLazy, PoolSyncBackground} {
+		pool, err := NewPool(WithPoolSize(2), WithPoolSync(mode))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i <= 3; i++ {
+			if err := pool.WriteTx(func(pl Prolog) error {
+				_, err := pl.QueryOnce(ctx, "retractall(gen(_)), assertz(gen(X)).", WithBind("X", int64(i)))
+				return err
+			}); err != nil {
+				t.Fatal(err)
+			}
+			// every replica sees the write
+			for range 4 {
+				if err := pool.ReadTx(func(pl Prolog) error {
+					_, err := pl.QueryOnce(ctx, "gen(X).", WithBind("X", int64(i)))
+					return err
+				}); err != nil {
+					t.Error(mode, i, err)
+				}
+			}
+		}
+	}
+}
+
+func TestPoolWrite(t *testing.T) {
+	ctx := context.Background()
+	pool, err := NewPool(WithPoolSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 50)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = pool.Write(ctx, func(pl Prolog) error {
+				_, err := pl.QueryOnce(ctx, "assertz(n(N)), N mod 10 =\\= 0.", WithBind("N", int64(i)))
+				return err
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if fail := i%10 == 0; fail != (err != nil) {
+			t.Error(i, err)
+		}
+	}
+	if err := pool.ReadTx(func(pl Prolog) error {
+		ans, err := pl.QueryOnce(ctx, "findall(N, n(N), Ns), length(Ns, Len), \\+ (member(N, Ns), N mod 10 =:= 0).")
+		if err != nil {
+			return err
+		}
+		if n := ans.Solution["Len"]; n != int64(45) {
+			t.Error("wrong count:", n)
+		}
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPoolWritePanic(t *testing.T) {
+	ctx := context.Background()
+	pool, err := NewPool(WithPoolSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = pool.Write(ctx, func(pl Prolog) error {
+		if _, err := pl.QueryOnce(ctx, "assertz(lost)."); err != nil {
+			return err
+		}
+		panic("oops")
+	})
+	if err == nil {
+		t.Fatal("expected error from panicking tx")
+	}
+
+	// the pool must not be stuck writing
+	if err := pool.Write(ctx, func(pl Prolog) error {
+		_, err := pl.QueryOnce(ctx, "assertz(kept).")
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.ReadTx(func(pl Prolog) error {
+		if _, err := pl.QueryOnce(ctx, "kept, \\+ catch(lost, _, fail)."); err != nil {
+			t.Error(err)
+		}
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+}
+
 func BenchmarkPool4(b *testing.B) {
 	benchmarkPool(b, 4)
 }
@@ -11,10 +11,14 @@ import (
 	"log"
 	"maps"
 	"runtime"
+	"slices"
 	"sync"
+	"time"
 
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
+	experimentalsys "github.com/tetratelabs/wazero/experimental/sys"
+	"github.com/tetratelabs/wazero/experimental/sysfs"
 )
 
 const defaultConcurrency = 256
@@ -31,10 +35,16 @@ type Prolog interface {
 	ConsultText(ctx context.Context, module string, text string) error
 	// Register a native Go predicate.
 	// NOTE: this is *experimental* and its API will likely change.
-	Register(ctx context.Context, name string, arity int, predicate Predicate) error
+	Register(ctx context.Context, name string, arity int, predicate Predicate, options ...RegisterOption) error
 	// Register a native Go nondeterminate predicate.
 	// By returning a sequence of terms, a [NondetPredicate] can create multiple choice points.
 	RegisterNondet(ctx context.Context, name string, arity int, predicate NondetPredicate) error
+	// BindChannel exposes a Go channel to Prolog as name, for use with chan_send/2 and chan_recv/2.
+	// Binding a nil channel removes it.
+	BindChannel(name Atom, ch chan Term)
+	// InvalidateCache clears the cached results of a native predicate registered using [WithCache].
+	// pi is its predicate indicator, such as "foo/2".
+	InvalidateCache(pi string)
 	// Clone creates a new clone of this interpreter.
 	Clone() (Prolog, error)
 	// Close destroys the Prolog instance.
@@ -42,9 +52,54 @@ type Prolog interface {
 	Close()
 	// Stats returns diagnostic information.
 	Stats() Stats
+	// Compact rebuilds the interpreter in a fresh instance, reclaiming its memory.
+	// Wasm memory never shrinks otherwise, and this build of Trealla has no garbage collector to call.
+	// Loaded code, the dynamic database, operators, flags, global variables set with nb_setval/2 or SetGlobal,
+	// and registered native predicates are carried over; streams are not. Fails if any queries are open.
+	Compact(ctx context.Context) error
+	// Dump writes the knowledgebase as consultable Prolog text:
+	// operator directives, module declarations, clauses (including dynamic facts), and flag directives.
+	// Native predicates are left out.
+	Dump(ctx context.Context, w io.Writer, options ...DumpOption) error
+	// OpenQueries returns information about queries that haven't been closed yet, oldest first.
+	OpenQueries() []QueryInfo
+	// Open starts a query and returns a cursor ID for it, to be used with Fetch.
+	// Cursors are closed when exhausted, when closed by CloseCursor, or after being idle for longer than their TTL.
+	// See [WithCursorTTL] and [WithCursorLimit].
+	Open(ctx context.Context, goal string, options ...CursorOption) (string, error)
+	// Fetch returns up to n answers from the cursor with the given ID, and whether more answers remain.
+	// Exhausted cursors are closed automatically.
+	Fetch(ctx context.Context, id string, n int) ([]Answer, bool, error)
+	// CloseCursor closes the cursor with the given ID, reporting whether it existed.
+	CloseCursor(id string) bool
+	// Mount makes fsys available at alias, replacing any previous mount there.
+	// Unlike [WithMapFS], this works on a live interpreter. Clones inherit mounts.
+	// Aliases mapped with [WithMapDir] or [WithMapFS] take precedence over mounts beneath them.
+	Mount(alias string, fsys fs.FS) error
+	// Unmount removes the mount at alias, reporting whether it existed.
+	Unmount(alias string) bool
+	// GetFlag returns the value of the Prolog flag name.
+	GetFlag(ctx context.Context, name Atom) (Term, error)
+	// SetFlag sets the Prolog flag name to value.
+	SetFlag(ctx context.Context, name Atom, value Term) error
+	// Op defines an operator, like op/3. A priority of 0 removes it.
+	Op(ctx context.Context, priority int, specifier Atom, name Atom) error
+	// CurrentOps returns the current operator table.
+	CurrentOps(ctx context.Context) (Operators, error)
+	// Marshal is like [Marshal], but writes terms with the operators defined in this interpreter
+	// (by Op, or by op/3 in queries) in operator notation.
+	// Text sent to the interpreter, such as bindings and the results of native predicates, is written the same way.
+	Marshal(term Term, options ...MarshalOption) (string, error)
+	// SetGlobal sets the global variable key to value, as in nb_setval/2.
+	// Prolog code can read it with nb_getval/2 or b_getval/2.
+	SetGlobal(ctx context.Context, key Atom, value Term) error
+	// GetGlobal returns the value of the global variable key, as in nb_getval/2.
+	// Returns an error satisfying [IsFailure] if it isn't set.
+	GetGlobal(ctx context.Context, key Atom) (Term, error)
 }
 
 type prolog struct {
+	rt       *Runtime
 	ctx      context.Context
 	instance api.Module
 	memory   api.Memory
@@ -65,18 +120,51 @@ type prolog struct {
 	pl_query         wasmFunc
 	pl_redo          wasmFunc
 	pl_done          wasmFunc
+	pl_yield_at      wasmFunc
+	query_did_yield  wasmFunc
 	// get_error        wasmFunc
 
-	procs map[string]Predicate
-	coros map[int64]coroutine
-	coron int64
+	procs  map[string]Predicate
+	caches map[string]*predicateCache
+	coros  map[int64]coroutine
+	coron  int64
+
+	alarms map[int64]*alarm
+	alarmn int64
+
+	chans  map[Atom]chan Term
+	shared *sharedStore
+	// globals are the keys set with nb_setval/2, see Compact
+	globals map[Atom]struct{}
+	// operators are the ones that differ from a fresh interpreter's, and ops their table (nil if none)
+	operators Operators
+	ops       *opTable
+
+	open          map[uint64]*queryInfo
+	openn         uint64
+	leaks         int
+	idleTimeout   time.Duration
+	leakDetection bool
+	leakHook      func(QueryInfo)
+
+	// pool is set for the replicas of a Pool
+	pool *Pool
+
+	cursors     *cursorRegistry
+	cursorTTL   time.Duration
+	cursorLimit int
 
 	dirs    map[string]string
 	fs      map[string]fs.FS
+	mounts  *mountTable
 	library string
 	trace   bool
 	quiet   bool
 	max     int
+	// maxDepth limits the nesting of decoded terms, see WithMaxDepth
+	maxDepth int
+	// textLists decodes text in answers as Chars and Codes, see WithTextLists
+	textLists bool
 
 	stdout *log.Logger
 	stderr *log.Logger
@@ -90,16 +178,25 @@ type prologKey struct{}
 // New creates a new Prolog interpreter.
 func New(opts ...Option) (Prolog, error) {
 	pl := &prolog{
-		running:  make(map[uint32]*query),
-		spawning: make(map[uint32]*query),
-		procs:    make(map[string]Predicate),
-		coros:    make(map[int64]coroutine),
-		mu:       new(sync.Mutex),
-		max:      defaultConcurrency,
+		running:     make(map[uint32]*query),
+		spawning:    make(map[uint32]*query),
+		procs:       make(map[string]Predicate),
+		caches:      make(map[string]*predicateCache),
+		coros:       make(map[int64]coroutine),
+		alarms:      make(map[int64]*alarm),
+		chans:       make(map[Atom]chan Term),
+		shared:      newSharedStore(),
+		globals:     make(map[Atom]struct{}),
+		open:        make(map[uint64]*queryInfo),
+		mu:          new(sync.Mutex),
+		max:         defaultConcurrency,
+		maxDepth:    DefaultMaxDepth,
+		cursorLimit: defaultCursorLimit,
 	}
 	for _, opt := range opts {
 		opt(pl)
 	}
+	pl.cursors = newCursorRegistry(pl.cursorTTL, pl.cursorLimit, 0)
 	if pl.max > 0 {
 		pl.limiter = make(chan struct{}, pl.max)
 	}
@@ -122,13 +219,33 @@ func (pl *prolog) argv() []string {
 
 func (pl *prolog) init(parent *prolog) error {
 	argv := pl.argv()
+	if parent != nil {
+		pl.dirs = parent.dirs
+		pl.fs = parent.fs
+	}
+	// mount in a stable order: clones must match the preopens of their parent
 	fs := wazero.NewFSConfig()
-	for alias, dir := range pl.dirs {
-		fs = fs.WithDirMount(dir, alias)
+	var root experimentalsys.FS
+	for _, alias := range slices.Sorted(maps.Keys(pl.dirs)) {
+		if alias == "/" {
+			root = sysfs.DirFS(pl.dirs[alias])
+			continue
+		}
+		fs = fs.WithDirMount(pl.dirs[alias], alias)
 	}
-	for alias, fsys := range pl.fs {
-		fs = fs.WithFSMount(fsys, alias)
+	for _, alias := range slices.Sorted(maps.Keys(pl.fs)) {
+		if alias == "/" {
+			root = &sysfs.AdaptFS{FS: pl.fs[alias]}
+			continue
+		}
+		fs = fs.WithFSMount(pl.fs[alias], alias)
 	}
+	// the root is mounted through a table so that Mount can add to it later
+	pl.mounts = newMountTable(root)
+	if parent != nil {
+		pl.mounts.inherit(parent.mounts)
+	}
+	fs = fs.(sysfs.FSConfig).WithSysFSMount(pl.mounts, "/")
 
 	cfg := wazero.NewModuleConfig().WithName("").WithArgs(argv...).WithFSConfig(fs).
 		WithSysWalltime().WithSysNanotime().WithSysNanosleep().
@@ -141,8 +258,15 @@ func (pl *prolog) init(parent *prolog) error {
 		cfg = cfg.WithStartFunctions()
 	}
 
+	if parent != nil {
+		pl.rt = parent.rt
+	}
+	if pl.rt == nil {
+		pl.rt = defaultRuntime
+	}
+
 	pl.ctx = context.WithValue(context.Background(), prologKey{}, pl)
-	instance, err := wasmEngine.InstantiateModule(pl.ctx, wasmModule, cfg)
+	instance, err := pl.rt.engine.InstantiateModule(pl.ctx, pl.rt.module, cfg)
 	if err != nil {
 		return err
 	}
@@ -194,6 +318,16 @@ func (pl *prolog) init(parent *prolog) error {
 		return err
 	}
 
+	pl.pl_yield_at, err = pl.function("pl_yield_at")
+	if err != nil {
+		return err
+	}
+
+	pl.query_did_yield, err = pl.function("query_did_yield")
+	if err != nil {
+		return err
+	}
+
 	// pl.get_error, err = pl.function("get_error")
 	// if err != nil {
 	// 	return err
@@ -214,14 +348,27 @@ func (pl *prolog) init(parent *prolog) error {
 		pl.spawning = make(map[uint32]*query)
 
 		pl.procs = maps.Clone(parent.procs)
+		pl.caches = maps.Clone(parent.caches)
 		pl.coros = make(map[int64]coroutine) // TODO: copy over? probably not
+		pl.alarms = make(map[int64]*alarm)
+		pl.chans = maps.Clone(parent.chans)
+		pl.shared = parent.shared
+		pl.globals = maps.Clone(parent.globals)
+		pl.setOperators(parent.operators)
+		pl.open = make(map[uint64]*queryInfo)
 
-		pl.dirs = parent.dirs
-		pl.fs = parent.fs
 		pl.library = parent.library
 		pl.quiet = parent.quiet
 		pl.trace = parent.trace
+		pl.maxDepth = parent.maxDepth
+		pl.textLists = parent.textLists
 		pl.debug = parent.debug
+		pl.idleTimeout = parent.idleTimeout
+		pl.leakDetection = parent.leakDetection
+		pl.leakHook = parent.leakHook
+		pl.cursorTTL = parent.cursorTTL
+		pl.cursorLimit = parent.cursorLimit
+		pl.cursors = newCursorRegistry(pl.cursorTTL, pl.cursorLimit, 0)
 		if parent.max > 0 {
 			pl.max = parent.max
 			pl.limiter = make(chan struct{}, pl.max)
@@ -370,16 +517,16 @@ func (pl *prolog) consultText(ctx context.Context, module, text string) error {
 	return err
 }
 
-func (pl *prolog) Consult(_ context.Context, filename string) error {
+func (pl *prolog) Consult(ctx context.Context, filename string) error {
 	pl.mu.Lock()
 	defer pl.mu.Unlock()
 	if pl.instance == nil {
 		return io.EOF
 	}
-	return pl.consult(filename)
+	return pl.consult(ctx, filename)
 }
 
-func (pl *prolog) consult(filename string) error {
+func (pl *prolog) consult(ctx context.Context, filename string) error {
 	fstr, err := newCString(pl, filename)
 	if err != nil {
 		return err
@@ -393,7 +540,7 @@ func (pl *prolog) consult(filename string) error {
 	if uint32(ret[0]) == 0 {
 		return fmt.Errorf("trealla: failed to consult file: %s", filename)
 	}
-	return nil
+	return pl.refreshOperators(ctx)
 }
 
 func (pl *prolog) indirect(ptr uint32) uint32 {
@@ -407,6 +554,11 @@ func (pl *prolog) indirect(ptr uint32) uint32 {
 
 type Stats struct {
 	MemorySize int
+	// OpenQueries is the number of queries that haven't been closed yet.
+	OpenQueries int
+	// LeakedQueries is the number of queries that were garbage collected
+	// or reaped for being idle without being closed.
+	LeakedQueries int
 }
 
 func (pl *prolog) Stats() Stats {
@@ -421,7 +573,9 @@ func (pl *prolog) stats() Stats {
 	}
 	size, _ := pl.memory.Grow(0)
 	return Stats{
-		MemorySize: int(size) * pageSize,
+		MemorySize:    int(size) * pageSize,
+		OpenQueries:   len(pl.open),
+		LeakedQueries: pl.leaks,
 	}
 }
 
@@ -472,18 +626,18 @@ func (pl *lockedProlog) ConsultText(ctx context.Context, module, text string) er
 	return pl.prolog.consultText(ctx, module, text)
 }
 
-func (pl *lockedProlog) Consult(_ context.Context, filename string) error {
+func (pl *lockedProlog) Consult(ctx context.Context, filename string) error {
 	if err := pl.ensure(); err != nil {
 		return err
 	}
-	return pl.prolog.consult(filename)
+	return pl.prolog.consult(ctx, filename)
 }
 
-func (pl *lockedProlog) Register(ctx context.Context, name string, arity int, proc Predicate) error {
+func (pl *lockedProlog) Register(ctx context.Context, name string, arity int, proc Predicate, options ...RegisterOption) error {
 	if err := pl.ensure(); err != nil {
 		return err
 	}
-	return pl.prolog.register(ctx, name, arity, proc)
+	return pl.prolog.register(ctx, name, arity, proc, options...)
 }
 
 func (pl *lockedProlog) RegisterNondet(ctx context.Context, name string, arity int, proc NondetPredicate) error {
@@ -597,6 +751,28 @@ func WithMaxConcurrency(queries int) Option {
 	}
 }
 
+// WithMaxDepth limits how deeply terms in answers and host calls may be nested.
+// Deeper terms make the query fail with an error wrapping [ErrTooDeep].
+// The default is [DefaultMaxDepth]. Set to 0 to disable the limit.
+// Either way, answers nested deeper than encoding/json accepts (about 5000 levels) fail to decode.
+// See [WithMarshalMaxDepth] for the limit of [Marshal].
+func WithMaxDepth(depth int) Option {
+	return func(pl *prolog) {
+		pl.maxDepth = depth
+	}
+}
+
+// WithTextLists decodes text in answers as [Chars] and [Codes] instead of string and []Term.
+// Trealla stores double-quoted strings as lists of characters, so strings are decoded as Chars too.
+// Non-empty lists of valid character codes are decoded as Codes,
+// including lists of small integers that weren't meant as text.
+// Terms received by native predicates aren't affected.
+func WithTextLists() Option {
+	return func(pl *prolog) {
+		pl.textLists = true
+	}
+}
+
 var (
 	_ Prolog = (*prolog)(nil)
 	_ Prolog = (*lockedProlog)(nil)
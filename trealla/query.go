@@ -5,10 +5,12 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"iter"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 )
 
 const stx = '\x02' // START OF TEXT
@@ -40,6 +42,30 @@ type query struct {
 
 	// in-flight coroutines
 	coros map[int64]struct{}
+	// pending alarms
+	alarms map[int64]struct{}
+	// host call waiting to be resumed
+	suspended *suspension
+	// native predicate restrictions
+	limits *guard
+	// Go errors behind exceptions thrown by native predicates, keyed by go_error/2 ID, see remember
+	causes map[int64]error
+	// b_setval/2 goals for globals, see WithGlobal
+	globals []Compound
+	// the goal might call op/3, so the operators are reread when it's closed
+	rereadOps bool
+	// file systems mounted for this query, see WithQueryFS
+	mounts map[string]fs.FS
+	// mounts visible to this query, including those of its callers
+	scope mountScope
+
+	// open query bookkeeping
+	id   uint64
+	info *queryInfo
+	idle *time.Timer
+
+	// context of the current Next call
+	ctx context.Context
 
 	cur  Answer
 	next *Answer
@@ -63,7 +89,7 @@ type query struct {
 // Query executes a query, returning an iterator for results.
 func (pl *prolog) Query(ctx context.Context, goal string, options ...QueryOption) Query {
 	q := pl.start(ctx, goal, options...)
-	runtime.SetFinalizer(q, (*query).Close)
+	runtime.SetFinalizer(q, (*query).finalize)
 	return q
 }
 
@@ -157,12 +183,14 @@ func (q *query) resetOutput() {
 
 func (pl *prolog) start(ctx context.Context, goal string, options ...QueryOption) *query {
 	q := &query{
-		pl:     pl,
-		goal:   goal,
-		lock:   true,
-		stdout: new(bytes.Buffer),
-		stderr: new(bytes.Buffer),
-		mu:     new(sync.Mutex),
+		pl:        pl,
+		goal:      goal,
+		ctx:       ctx,
+		lock:      true,
+		rereadOps: strings.Contains(goal, "op("),
+		stdout:    new(bytes.Buffer),
+		stderr:    new(bytes.Buffer),
+		mu:        new(sync.Mutex),
 	}
 	for _, opt := range options {
 		opt(q)
@@ -176,10 +204,12 @@ func (pl *prolog) start(ctx context.Context, goal string, options ...QueryOption
 		pl.mu.Lock()
 		defer pl.mu.Unlock()
 	}
+	pl.track(q)
 	if q.pl.instance == nil || pl.closing {
 		q.setError(io.EOF)
 		return q
 	}
+	q.scope = pl.mounts.scopeFor(q.mounts)
 
 	if err := q.reify(); err != nil {
 		q.setError(err)
@@ -211,6 +241,11 @@ func (pl *prolog) start(ctx context.Context, goal string, options ...QueryOption
 		return q
 	}
 
+	var yield uint64
+	if len(q.alarms) > 0 {
+		yield = yieldInterval
+	}
+
 	ch := make(chan error, 2)
 	var ret uint32
 	go func() {
@@ -220,7 +255,9 @@ func (pl *prolog) start(ctx context.Context, goal string, options ...QueryOption
 			}
 		}()
 
-		v, err := pl.pl_query.Call(pl.ctx, uint64(pl.ptr), uint64(goalstr.ptr), uint64(subqptr), 0)
+		leave := pl.mounts.enter(q.scope)
+		v, err := pl.pl_query.Call(pl.ctx, uint64(pl.ptr), uint64(goalstr.ptr), uint64(subqptr), yield)
+		leave()
 		if err == nil {
 			ret = uint32(v[0])
 		}
@@ -252,6 +289,14 @@ func (pl *prolog) start(ctx context.Context, goal string, options ...QueryOption
 			q.pl.running[q.subquery] = q
 		}
 
+		if err := q.resume(ctx); err != nil {
+			q.setError(err)
+			return q
+		}
+		if q.done {
+			delete(pl.running, q.subquery)
+		}
+
 		if err := q.readOutput(); err != nil {
 			q.setError(err)
 			return q
@@ -284,12 +329,12 @@ func (q *query) redo(ctx context.Context) bool {
 		q.setError(io.EOF)
 		return false
 	}
-
 	if q.pl.debug != nil {
 		q.pl.debug.Println("redo:", q.subquery, q.goal)
 	}
 
 	pl := q.pl
+	q.ctx = ctx
 
 	ch := make(chan error, 2)
 	var ret uint32
@@ -300,7 +345,9 @@ func (q *query) redo(ctx context.Context) bool {
 			}
 		}()
 
+		leave := pl.mounts.enter(q.scope)
 		v, err := pl.pl_redo.Call(pl.ctx, uint64(q.subquery))
+		leave()
 		if err == nil {
 			ret = uint32(v[0])
 		}
@@ -321,6 +368,11 @@ func (q *query) redo(ctx context.Context) bool {
 			return false
 		}
 
+		if err := q.resume(ctx); err != nil {
+			q.setError(err)
+			return false
+		}
+
 		// var erroring bool
 		// var errcode uint64
 		// {
@@ -385,6 +437,7 @@ func (q *query) redo(ctx context.Context) bool {
 func (q *query) Next(ctx context.Context) bool {
 	q.mu.Lock()
 	defer q.mu.Unlock()
+	defer q.touch()
 
 	if q.err != nil {
 		return false
@@ -407,6 +460,8 @@ func (q *query) Next(ctx context.Context) bool {
 
 func (q *query) push(a Answer) {
 	q.next = &a
+	// exceptions thrown by native predicates until now were caught
+	clear(q.causes)
 }
 
 func (q *query) pop() bool {
@@ -455,6 +510,7 @@ func (q *query) Close() error {
 func (q *query) close() error {
 	if !q.dead {
 		q.dead = true
+		q.pl.untrack(q)
 		if q.pl.limiter != nil {
 			defer func() {
 				<-q.pl.limiter
@@ -466,6 +522,10 @@ func (q *query) close() error {
 			}
 			q.pl.CoroStop(Subquery(q.subquery), coro)
 		}
+		for id := range q.alarms {
+			q.pl.AlarmStop(id)
+		}
+		q.suspended = nil
 	}
 
 	if q.subquery != 0 {
@@ -495,6 +555,14 @@ func (q *query) close() error {
 		q.stderrlen = 0
 	}
 
+	if q.rereadOps {
+		q.rereadOps = false
+		if q.pl.instance != nil && !q.pl.closing {
+			// on error, the table stays as it was
+			q.pl.refreshOperators(context.Background())
+		}
+	}
+
 	// q.pl = nil
 
 	return nil
@@ -515,19 +583,37 @@ func (q *query) bindVar(name string, value Term) {
 }
 
 func (q *query) reify() error {
-	if len(q.bind) == 0 {
+	if len(q.bind) == 0 && len(q.globals) == 0 {
 		return nil
 	}
 
 	var sb strings.Builder
-	sb.WriteString(q.bind.String())
-	sb.WriteString(", ")
+	if len(q.bind) > 0 {
+		text, err := q.bind.marshal(q.pl.ops)
+		if err != nil {
+			return err
+		}
+		sb.WriteString(text)
+		sb.WriteString(", ")
+	}
+	for _, put := range q.globals {
+		text, err := marshalOps(put, q.pl.ops)
+		if err != nil {
+			return err
+		}
+		sb.WriteString(text)
+		sb.WriteString(", ")
+	}
 	sb.WriteString(q.goal)
 	q.goal = sb.String()
 	return nil
 }
 
 func (q *query) setError(err error) {
+	if ex, ok := err.(ErrThrow); ok && ex.cause == nil {
+		ex.cause = q.cause(ex.Ball)
+		err = ex
+	}
 	if err != nil && q.err == nil {
 		q.err = err
 	}
@@ -566,6 +652,11 @@ func WithBinding(subs Substitution) QueryOption {
 	}
 }
 
+// withKnownOps is for queries that don't change the operators, or update the table themselves.
+func withKnownOps(q *query) {
+	q.rereadOps = false
+}
+
 func withoutLock(q *query) {
 	q.lock = false
 }
@@ -0,0 +1,146 @@
+package trealla
+
+import (
+	"sync"
+)
+
+// sharedStore is the key-value store behind shared_get/2 and friends.
+// It is shared by an interpreter, its clones, and the replicas of a Pool.
+type sharedStore struct {
+	// keyed by the marshaled key
+	entries map[string]sharedEntry
+	mu      sync.Mutex
+}
+
+type sharedEntry struct {
+	value Term
+	// text is the marshaled value, for comparisons
+	text string
+}
+
+func newSharedStore() *sharedStore {
+	return &sharedStore{
+		entries: make(map[string]sharedEntry),
+	}
+}
+
+// sharedArg checks that a key or value is ground, returning its text.
+func sharedArg(arg Term, pi Compound) (string, Term) {
+	if !isGround(arg) {
+		return "", throwTerm(Atom("error").Of(Atom("instantiation_error"), pi))
+	}
+	text, err := marshal(arg)
+	if err != nil {
+		return "", domainError("term", arg, pi)
+	}
+	return text, nil
+}
+
+func isGround(t Term) bool {
+	switch t := t.(type) {
+	case Variable:
+		return false
+	case Compound:
+		for _, arg := range t.Args {
+			if !isGround(arg) {
+				return false
+			}
+		}
+	case []Term:
+		for _, x := range t {
+			if !isGround(x) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// shared_get(+Key, ?Value)
+func shared_get_2(pl Prolog, subquery Subquery, goal Term) Term {
+	g := goal.(Compound)
+	host, _ := native(pl, subquery)
+	key, ex := sharedArg(g.Args[0], g.pi())
+	if ex != nil {
+		return ex
+	}
+	store := host.shared
+	store.mu.Lock()
+	entry, ok := store.entries[key]
+	store.mu.Unlock()
+	if !ok {
+		return Atom("fail")
+	}
+	return Atom("shared_get").Of(g.Args[0], entry.value)
+}
+
+// shared_put(+Key, +Value)
+func shared_put_2(pl Prolog, subquery Subquery, goal Term) Term {
+	g := goal.(Compound)
+	host, _ := native(pl, subquery)
+	key, ex := sharedArg(g.Args[0], g.pi())
+	if ex != nil {
+		return ex
+	}
+	text, ex := sharedArg(g.Args[1], g.pi())
+	if ex != nil {
+		return ex
+	}
+	store := host.shared
+	store.mu.Lock()
+	store.entries[key] = sharedEntry{value: g.Args[1], text: text}
+	store.mu.Unlock()
+	return goal
+}
+
+// shared_cas(+Key, ?Old, +New)
+// Replaces the value of Key with New if it is currently Old.
+// An unbound Old means Key must not exist.
+func shared_cas_3(pl Prolog, subquery Subquery, goal Term) Term {
+	g := goal.(Compound)
+	host, _ := native(pl, subquery)
+	key, ex := sharedArg(g.Args[0], g.pi())
+	if ex != nil {
+		return ex
+	}
+	var old string
+	_, absent := g.Args[1].(Variable)
+	if !absent {
+		if old, ex = sharedArg(g.Args[1], g.pi()); ex != nil {
+			return ex
+		}
+	}
+	text, ex := sharedArg(g.Args[2], g.pi())
+	if ex != nil {
+		return ex
+	}
+
+	store := host.shared
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	entry, ok := store.entries[key]
+	if ok == absent || (ok && entry.text != old) {
+		return Atom("fail")
+	}
+	store.entries[key] = sharedEntry{value: g.Args[2], text: text}
+	return goal
+}
+
+// shared_delete(+Key)
+// Fails if Key doesn't exist.
+func shared_delete_1(pl Prolog, subquery Subquery, goal Term) Term {
+	g := goal.(Compound)
+	host, _ := native(pl, subquery)
+	key, ex := sharedArg(g.Args[0], g.pi())
+	if ex != nil {
+		return ex
+	}
+	store := host.shared
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.entries[key]; !ok {
+		return Atom("fail")
+	}
+	delete(store.entries, key)
+	return goal
+}
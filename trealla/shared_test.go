@@ -0,0 +1,75 @@
+package trealla
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestShared(t *testing.T) {
+	ctx := context.Background()
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("basics", func(t *testing.T) {
+		ans, err := pl.QueryOnce(ctx, `shared_put(k, v(1)), shared_get(k, V),
+			\+ shared_cas(k, v(2), v(3)), shared_cas(k, v(1), v(3)), shared_get(k, V2),
+			shared_delete(k), \+ shared_get(k, _), \+ shared_delete(k),
+			shared_cas(new, _, 1), \+ shared_cas(new, _, 2), shared_get(new, New).`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Substitution{"V": Atom("v").Of(int64(1)), "V2": Atom("v").Of(int64(3)), "New": int64(1)}
+		if !reflect.DeepEqual(want, ans.Solution) {
+			t.Error("want:", want, "got:", ans.Solution)
+		}
+	})
+
+	t.Run("not ground", func(t *testing.T) {
+		_, err := pl.QueryOnce(ctx, `shared_put(k, f(_)).`)
+		if err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("pool", func(t *testing.T) {
+		pool, err := NewPool(WithPoolSize(4))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := pool.WriteTx(func(pl Prolog) error {
+			_, err := pl.QueryOnce(ctx, `shared_put(hits, 0).`)
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		var wg sync.WaitGroup
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				pool.ReadTx(func(pl Prolog) error {
+					_, err := pl.QueryOnce(ctx, `repeat, shared_get(hits, N0), N is N0 + 1, shared_cas(hits, N0, N), !.`)
+					if err != nil {
+						t.Error(err)
+					}
+					return err
+				})
+			}()
+		}
+		wg.Wait()
+		pool.ReadTx(func(pl Prolog) error {
+			ans, err := pl.QueryOnce(ctx, `shared_get(hits, N).`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := ans.Solution["N"]; n != int64(20) {
+				t.Error("want 20, got:", n)
+			}
+			return nil
+		})
+	})
+}
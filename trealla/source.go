@@ -0,0 +1,371 @@
+package trealla
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// moduleSource is the Prolog text of a module's predicates.
+type moduleSource struct {
+	name Atom
+	// exports is the export list of the module declaration, nil for user
+	exports []Term
+	preds   []predicateSource
+}
+
+// predicateSource is the Prolog text of a predicate.
+type predicateSource struct {
+	// pi is the predicate indicator, such as foo/2
+	pi      string
+	dynamic bool
+	// clauses each end with a period
+	clauses []string
+}
+
+// String returns consultable Prolog text for this module.
+func (ms moduleSource) String() string {
+	var sb strings.Builder
+	if ms.name != "user" {
+		sb.WriteString(":- ")
+		sb.WriteString(Atom("module").Of(ms.name, ms.exports).String())
+		sb.WriteString(".\n")
+	}
+	for _, pred := range ms.preds {
+		if pred.dynamic {
+			sb.WriteString(":- dynamic(" + pred.pi + ").\n")
+		}
+		for _, clause := range pred.clauses {
+			sb.WriteString(clause)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+// kbSource is the knowledgebase of an interpreter as Prolog text.
+type kbSource struct {
+	// ops are op/3 goals that set up operators, needed before reading the modules
+	ops []Term
+	// modules are the module sources, starting with user
+	modules []moduleSource
+	// flags are set_prolog_flag/2 goals, to be called after loading the modules
+	flags []Term
+}
+
+// sourceOptions configures an export of the knowledgebase.
+type sourceOptions struct {
+	// modules to include, or all if empty
+	modules []Atom
+	// natives includes the shims of predicates registered with Register
+	natives bool
+}
+
+// baseline is the knowledgebase of a fresh interpreter,
+// used to tell which modules, operators and flags were added since.
+type baseline struct {
+	modules map[Atom]struct{}
+	ops     map[string]Term
+	flags   map[Atom]Term
+}
+
+var (
+	baselineKB *baseline
+	baselineMu sync.Mutex
+)
+
+// loadBaseline returns the baseline, computing it on first use.
+// Errors aren't kept, so a canceled ctx doesn't spoil later calls.
+func loadBaseline(ctx context.Context) (*baseline, error) {
+	baselineMu.Lock()
+	defer baselineMu.Unlock()
+	if baselineKB != nil {
+		return baselineKB, nil
+	}
+
+	pl, err := New(WithMaxConcurrency(0))
+	if err != nil {
+		return nil, err
+	}
+	defer pl.Close()
+	p := pl.(*prolog)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	base := &baseline{
+		modules: make(map[Atom]struct{}),
+	}
+	modules, err := p.currentModules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range modules {
+		base.modules[m] = struct{}{}
+	}
+	if base.ops, err = p.currentOps(ctx); err != nil {
+		return nil, err
+	}
+	if base.flags, err = p.currentFlags(ctx); err != nil {
+		return nil, err
+	}
+	baselineKB = base
+	return base, nil
+}
+
+// readOnlyFlags can't be set, differ between instances, or are set by options.
+var readOnlyFlags = map[Atom]struct{}{
+	"bounded":                   {},
+	"cpu_count":                 {},
+	"dialect":                   {},
+	"encoding":                  {},
+	"integer_rounding_function": {},
+	"max_arity":                 {},
+	"pid":                       {},
+	"threads":                   {},
+	"unix":                      {},
+	"verbose":                   {},
+	"version":                   {},
+}
+
+// source exports the knowledgebase as Prolog text.
+func (pl *prolog) source(ctx context.Context, opts sourceOptions) (kbSource, error) {
+	var src kbSource
+	base, err := loadBaseline(ctx)
+	if err != nil {
+		return src, err
+	}
+
+	modules, err := pl.currentModules(ctx)
+	if err != nil {
+		return src, err
+	}
+	// user first, then modules in the order they were loaded
+	modules = slices.DeleteFunc(modules, func(m Atom) bool {
+		_, builtin := base.modules[m]
+		return builtin && m != "user"
+	})
+	if len(opts.modules) > 0 {
+		modules = slices.DeleteFunc(modules, func(m Atom) bool {
+			return !slices.Contains(opts.modules, m)
+		})
+	}
+	for _, m := range modules {
+		ms, err := pl.moduleSource(ctx, m, base, opts)
+		if err != nil {
+			return src, err
+		}
+		src.modules = append(src.modules, ms)
+	}
+
+	ops, err := pl.currentOps(ctx)
+	if err != nil {
+		return src, err
+	}
+	for key, op := range ops {
+		if prev, ok := base.ops[key]; !ok || !reflect.DeepEqual(prev, op) {
+			src.ops = append(src.ops, op)
+		}
+	}
+	for key, op := range base.ops {
+		if _, ok := ops[key]; !ok {
+			// removed
+			op := op.(Compound)
+			src.ops = append(src.ops, Atom("op").Of(int64(0), op.Args[1], op.Args[2]))
+		}
+	}
+	slices.SortFunc(src.ops, func(a, b Term) int {
+		return strings.Compare(a.(Compound).String(), b.(Compound).String())
+	})
+
+	flags, err := pl.currentFlags(ctx)
+	if err != nil {
+		return src, err
+	}
+	for name, value := range flags {
+		if _, ok := readOnlyFlags[name]; ok {
+			continue
+		}
+		if prev, ok := base.flags[name]; ok && reflect.DeepEqual(prev, value) {
+			continue
+		}
+		src.flags = append(src.flags, Atom("set_prolog_flag").Of(name, value))
+	}
+	slices.SortFunc(src.flags, func(a, b Term) int {
+		return strings.Compare(a.(Compound).String(), b.(Compound).String())
+	})
+
+	return src, nil
+}
+
+// sourceQuery writes a line for each predicate in PIs stating whether it's dynamic, followed by its clauses.
+// The first argument is the module qualifier: user: must be left out, as qualified clause lookups
+// of user predicates miss clauses added by assert.
+const sourceQuery = `forall(member(PI, %[2]s), (
+	PI = N/A, functor(H, N, A),
+	(   \+ \+ catch((%[1]sclause(H, _) -> true ; true), error(permission_error(_, _, _), _), fail)
+	->  D = '$dynamic'(PI)
+	;   D = '$static'(PI)
+	),
+	writeq(D), nl,
+	forall(((D = '$dynamic'(_) -> %[1]sclause(H, B) ; %[1]s'$clause'(H, B)), %[3]s), (
+		(B == true -> C = H ; C = (H :- B)),
+		numbervars(C, 0, _),
+		write_term(C, [quoted(true), numbervars(true), double_quotes(true)]), nl
+	))
+)).`
+
+func (pl *prolog) moduleSource(ctx context.Context, module Atom, base *baseline, opts sourceOptions) (moduleSource, error) {
+	ms := moduleSource{name: module}
+	preds, err := pl.currentPredicates(ctx, module)
+	if err != nil {
+		return ms, err
+	}
+	if module == "user" {
+		// builtins are defined by every interpreter
+		preds = slices.DeleteFunc(preds, func(pi Compound) bool {
+			return builtin(pi.String())
+		})
+	} else {
+		ans, err := pl.queryOnce(ctx, fmt.Sprintf("module_info(%s, Exports).", module.String()))
+		if err != nil {
+			return ms, fmt.Errorf("trealla: failed to get exports of module %s: %w", module, err)
+		}
+		ms.exports, _ = ans.Solution["Exports"].([]Term)
+		if ms.exports == nil {
+			ms.exports = []Term{}
+		}
+	}
+	if len(preds) == 0 {
+		return ms, nil
+	}
+
+	pis, err := marshal(preds)
+	if err != nil {
+		return ms, err
+	}
+	filter := `B \= wasm_generic:host_rpc(_)`
+	if opts.natives {
+		filter = "true"
+	}
+	var qualifier string
+	if module != "user" {
+		qualifier = module.String() + ":"
+	}
+	ans, err := pl.queryOnce(ctx, fmt.Sprintf(sourceQuery, qualifier, pis, filter))
+	if err != nil {
+		return ms, fmt.Errorf("trealla: failed to list clauses of module %s: %w", module, err)
+	}
+	for _, line := range strings.Split(ans.Stdout, "\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "'$dynamic'("):
+			pi := strings.TrimSuffix(strings.TrimPrefix(line, "'$dynamic'("), ")")
+			ms.preds = append(ms.preds, predicateSource{pi: pi, dynamic: true})
+		case strings.HasPrefix(line, "'$static'("):
+			pi := strings.TrimSuffix(strings.TrimPrefix(line, "'$static'("), ")")
+			ms.preds = append(ms.preds, predicateSource{pi: pi})
+		case len(ms.preds) > 0:
+			pred := &ms.preds[len(ms.preds)-1]
+			pred.clauses = append(pred.clauses, endClause(line))
+		}
+	}
+	ms.preds = slices.DeleteFunc(ms.preds, func(pred predicateSource) bool {
+		if len(pred.clauses) > 0 {
+			return false
+		}
+		// modules implicitly get these, only include them if they're used
+		hook := pred.pi == "goal_expansion/2" || pred.pi == "term_expansion/2" || pred.pi == "portray/1"
+		return hook || !pred.dynamic
+	})
+	return ms, nil
+}
+
+// endClause adds the terminating period to clause text.
+func endClause(text string) string {
+	if text != "" && strings.ContainsRune(`#$&*+-./:<=>?@^~\`, rune(text[len(text)-1])) {
+		// don't glue the end to a symbolic atom
+		return text + " ."
+	}
+	return text + "."
+}
+
+func (pl *prolog) currentModules(ctx context.Context) ([]Atom, error) {
+	ans, err := pl.queryOnce(ctx, "findall(M, current_module(M), Ms).")
+	if err != nil {
+		return nil, fmt.Errorf("trealla: failed to list modules: %w", err)
+	}
+	ms, _ := ans.Solution["Ms"].([]Term)
+	modules := make([]Atom, 0, len(ms))
+	for _, m := range ms {
+		if m, ok := m.(Atom); ok && !slices.Contains(modules, m) {
+			modules = append(modules, m)
+		}
+	}
+	return modules, nil
+}
+
+func (pl *prolog) currentPredicates(ctx context.Context, module Atom) ([]Compound, error) {
+	goal := fmt.Sprintf("current_predicate(%s:N/A)", module.String())
+	if module == "user" {
+		// current_predicate/1 doesn't see predicates created by assert,
+		// and lists the ones imported from libraries
+		goal = "((" + goal + ", functor(H, N, A) ; '$predicate_property'(predicate, H, (dynamic)), functor(H, N, A)), " +
+			"\\+ predicate_property(user:H, imported_from(_)))"
+	}
+	ans, err := pl.queryOnce(ctx, "findall(N/A, "+goal+", PIs).")
+	if err != nil {
+		return nil, fmt.Errorf("trealla: failed to list predicates of module %s: %w", module, err)
+	}
+	list, _ := ans.Solution["PIs"].([]Term)
+	preds := make([]Compound, 0, len(list))
+	for _, pi := range list {
+		pi, ok := pi.(Compound)
+		if !ok || len(pi.Args) != 2 {
+			continue
+		}
+		if name, _ := pi.Args[0].(Atom); strings.HasPrefix(string(name), "$") {
+			// internal
+			continue
+		}
+		if !slices.ContainsFunc(preds, func(other Compound) bool { return reflect.DeepEqual(pi, other) }) {
+			preds = append(preds, pi)
+		}
+	}
+	return preds, nil
+}
+
+func (pl *prolog) currentOps(ctx context.Context) (map[string]Term, error) {
+	ans, err := pl.queryOnce(ctx, "findall(op(P, T, N), current_op(P, T, N), Ops).", withKnownOps)
+	if err != nil {
+		return nil, fmt.Errorf("trealla: failed to list operators: %w", err)
+	}
+	list, _ := ans.Solution["Ops"].([]Term)
+	ops := make(map[string]Term, len(list))
+	for _, op := range list {
+		if op, ok := op.(Compound); ok {
+			// keyed by type and name
+			ops[Atom("op").Of(op.Args[1], op.Args[2]).String()] = op
+		}
+	}
+	return ops, nil
+}
+
+func (pl *prolog) currentFlags(ctx context.Context) (map[Atom]Term, error) {
+	ans, err := pl.queryOnce(ctx, "findall(F-V, current_prolog_flag(F, V), Flags).")
+	if err != nil {
+		return nil, fmt.Errorf("trealla: failed to list flags: %w", err)
+	}
+	list, _ := ans.Solution["Flags"].([]Term)
+	flags := make(map[Atom]Term, len(list))
+	for _, kv := range list {
+		if kv, ok := kv.(Compound); ok && len(kv.Args) == 2 {
+			if name, ok := kv.Args[0].(Atom); ok {
+				flags[name] = kv.Args[1]
+			}
+		}
+	}
+	return flags, nil
+}
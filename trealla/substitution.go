@@ -2,6 +2,7 @@ package trealla
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"reflect"
@@ -21,22 +22,32 @@ func (sub Substitution) String() string {
 }
 
 // UnmarshalJSON implements the encoding/json.Marshaler interface.
+// Terms may be nested up to [DefaultMaxDepth].
 func (sub *Substitution) UnmarshalJSON(bs []byte) error {
+	var err error
+	*sub, err = unmarshalSubstitution(bs, termDecoder{maxDepth: DefaultMaxDepth})
+	return err
+}
+
+func unmarshalSubstitution(bs []byte, d termDecoder) (Substitution, error) {
 	var raws map[string]json.RawMessage
 	dec := json.NewDecoder(bytes.NewReader(bs))
 	dec.UseNumber()
 	if err := dec.Decode(&raws); err != nil {
-		return err
+		return nil, err
 	}
-	*sub = make(Substitution, len(raws))
+	if raws == nil {
+		return nil, nil
+	}
+	sub := make(Substitution, len(raws))
 	for k, raw := range raws {
-		term, err := unmarshalTerm(raw)
+		term, err := unmarshalTerm(raw, d)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		(*sub)[k] = term
+		sub[k] = term
 	}
-	return nil
+	return sub, nil
 }
 
 type binding struct {
@@ -46,28 +57,83 @@ type binding struct {
 
 // Scan sets any fields in obj that match variables in this substitution.
 // obj must be a pointer to a struct or a map.
+//
+// Struct fields are matched by their prolog tag or name.
+// Tags can be dotted paths such as `prolog:"Order.customer"` to scan part of a variable's value:
+// each step selects a numbered (1-based) argument or list element, the value of a Key=Value pair,
+// or X from a compound's argument such as customer(X).
+// Struct fields that don't match a variable are scanned recursively.
+// If any fields fail to convert, the error is a [ScanError] listing all of them.
 func (sub Substitution) Scan(obj any) error {
 	rv := reflect.ValueOf(obj)
 	return scan(sub, rv)
 }
 
+// ScanAll scans every answer of q into a new element appended to the slice dst points to.
+// The slice's elements can be structs, maps, or pointers to structs, and are scanned like [Substitution.Scan].
+// A query that fails appends nothing and is not an error.
+// ScanAll closes q when it returns.
+func ScanAll(ctx context.Context, q Query, dst any) error {
+	defer q.Close()
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("trealla: must pass pointer to slice for ScanAll. got: %T", dst)
+	}
+	slice := rv.Elem()
+	etype := slice.Type().Elem()
+	for n := 1; q.Next(ctx); n++ {
+		var elem reflect.Value
+		if etype.Kind() == reflect.Pointer {
+			elem = reflect.New(etype.Elem())
+		} else {
+			elem = reflect.New(etype)
+		}
+		if err := q.Current().Solution.Scan(elem.Interface()); err != nil {
+			return fmt.Errorf("trealla: error scanning answer #%d: %w", n, err)
+		}
+		if etype.Kind() != reflect.Pointer {
+			elem = elem.Elem()
+		}
+		slice.Set(reflect.Append(slice, elem))
+	}
+	if err := q.Err(); err != nil && !IsFailure(err) {
+		return err
+	}
+	return nil
+}
+
 type bindings []binding
 
 func (bs bindings) String() string {
+	text, _ := bs.marshal(nil)
+	return text
+}
+
+// marshal writes bindings as Prolog unifications, using ops if not nil.
+// Values that can't be marshaled are written as placeholders, and the first such error is returned.
+func (bs bindings) marshal(ops *opTable) (string, error) {
 	var sb strings.Builder
+	var first error
 	for i, bind := range bs {
 		if i != 0 {
 			sb.WriteString(", ")
 		}
 		sb.WriteString(bind.name)
 		sb.WriteString(" = ")
-		v, err := marshal(bind.value)
-		if err != nil {
+		e := newEncoder(nil)
+		e.maxDepth = 0
+		e.ops = ops
+		// as the right side of =/2
+		if err := e.encode(bind.value, 699); err != nil {
 			sb.WriteString(fmt.Sprintf("<error: %v>", err))
+			if first == nil {
+				first = fmt.Errorf("trealla: can't bind %s: %w", bind.name, err)
+			}
+			continue
 		}
-		sb.WriteString(v)
+		sb.WriteString(e.String())
 	}
-	return sb.String()
+	return sb.String(), first
 }
 
 func (bs bindings) Less(i, j int) bool { return bs[i].name < bs[j].name }
@@ -2,6 +2,7 @@ package trealla
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -140,3 +141,84 @@ func ExampleSubstitution_Scan() {
 	fmt.Printf("%+v", result)
 	// Output: {X:123 Y:abc Hi:[hello world]}
 }
+
+func TestScanPaths(t *testing.T) {
+	order := Atom("order").Of(int64(7), Atom("customer").Of("alice"), []Term{Atom("=").Of(Atom("city"), "Tokyo")})
+	type address struct {
+		City string `prolog:"Order.3.city"`
+		// untagged fields of nested structs aren't matched to variables
+		ID int
+	}
+	var result struct {
+		ID       int    `prolog:"Order.1"`
+		Customer string `prolog:"Order.customer"`
+		Address  address
+		Missing  string `prolog:"Nope.x"`
+	}
+	if err := (Substitution{"Order": order, "ID": int64(1)}).Scan(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.ID != 7 || result.Customer != "alice" || result.Address.City != "Tokyo" || result.Address.ID != 0 {
+		t.Errorf("bad scan: %+v", result)
+	}
+
+	var bad struct {
+		A int      `prolog:"Order.customer"`
+		B string   `prolog:"Order.9"`
+		C Compound `prolog:"Order.1"`
+		D string
+	}
+	err := (Substitution{"Order": order, "D": "ok"}).Scan(&bad)
+	var scanErr ScanError
+	if !errors.As(err, &scanErr) {
+		t.Fatal("want ScanError, got:", err)
+	}
+	var fields []string
+	for _, f := range scanErr.Fields {
+		fields = append(fields, f.Field)
+	}
+	if want := []string{"A", "B", "C"}; !reflect.DeepEqual(fields, want) {
+		t.Error("want:", want, "got:", fields, err)
+	}
+	if bad.D != "ok" {
+		t.Error("valid field not set:", bad.D)
+	}
+}
+
+func TestScanAll(t *testing.T) {
+	ctx := context.Background()
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Close()
+
+	type row struct {
+		X int
+		Y Atom `prolog:"P.2"`
+	}
+	var rows []row
+	if err := ScanAll(ctx, pl.Query(ctx, `member(X-Y, [1-a, 2-b]), P = p(X, Y).`), &rows); err != nil {
+		t.Fatal(err)
+	}
+	if want := []row{{1, "a"}, {2, "b"}}; !reflect.DeepEqual(rows, want) {
+		t.Error("want:", want, "got:", rows)
+	}
+
+	var ptrs []*row
+	if err := ScanAll(ctx, pl.Query(ctx, `false.`), &ptrs); err != nil || len(ptrs) != 0 {
+		t.Error("want no rows, got:", ptrs, err)
+	}
+
+	var maps []map[string]Term
+	if err := ScanAll(ctx, pl.Query(ctx, `between(1, 3, X).`), &maps); err != nil || len(maps) != 3 {
+		t.Error("want 3 rows, got:", maps, err)
+	}
+
+	if err := ScanAll(ctx, pl.Query(ctx, `member(X, [1, foo]), Y = [].`), &rows); err == nil {
+		t.Error("expected error")
+	}
+	if err := ScanAll(ctx, pl.Query(ctx, `throw(oops).`), &rows); !errors.As(err, &ErrThrow{}) {
+		t.Error("want ErrThrow, got:", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Term is a Prolog term.
@@ -99,46 +100,13 @@ func (c Compound) pi() Compound {
 
 // String returns a Prolog representation of this Compound.
 func (c Compound) String() string {
-	if len(c.Args) == 0 {
-		return c.Functor.String()
+	e := newEncoder(nil)
+	e.maxDepth = 0
+	e.lenient = true
+	if err := e.compound(c, 1200); err != nil {
+		return fmt.Sprintf("<invalid: %v>", err)
 	}
-
-	var buf strings.Builder
-
-	// special case these two operators for now?
-	if len(c.Args) == 2 {
-		switch c.Functor {
-		case "/", ":":
-			left, err := marshal(c.Args[0])
-			if err != nil {
-				buf.WriteString(fmt.Sprintf("<invalid: %v>", err))
-			}
-			buf.WriteString(left)
-			buf.WriteString(string(c.Functor))
-			right, err := marshal(c.Args[1])
-			if err != nil {
-				buf.WriteString(fmt.Sprintf("<invalid: %v>", err))
-			}
-			buf.WriteString(right)
-			return buf.String()
-		}
-	}
-
-	buf.WriteString(c.Functor.String())
-	buf.WriteRune('(')
-	for i, arg := range c.Args {
-		if i > 0 {
-			buf.WriteString(", ")
-		}
-		text, err := marshal(arg)
-		if err != nil {
-			buf.WriteString(fmt.Sprintf("<invalid: %v>", err))
-			continue
-		}
-		buf.WriteString(text)
-	}
-	buf.WriteRune(')')
-	return buf.String()
+	return e.String()
 }
 
 func piTerm(functor Atom, arity int) Compound {
@@ -172,23 +140,21 @@ type compoundStruct interface {
 	functor() Functor
 }
 
+// Chars is text represented as a list of one-character atoms, such as [a, b, c].
+// Unlike string, it is written the same way regardless of the double_quotes flag.
+type Chars string
+
+// Codes is text represented as a list of character codes, such as [97, 98, 99].
+// Unlike string, it is written the same way regardless of the double_quotes flag.
+type Codes string
+
 // String returns the Prolog text representation of this variable.
 func (v Variable) String() string {
-	if len(v.Attr) == 0 {
-		return v.Name
+	e := newEncoder(nil)
+	if err := e.variable(v); err != nil {
+		return fmt.Sprintf("<invalid var: %v>", err)
 	}
-	var sb strings.Builder
-	for i, attr := range v.Attr {
-		if i != 0 {
-			sb.WriteString(", ")
-		}
-		text, err := marshal(attr)
-		if err != nil {
-			return fmt.Sprintf("<invalid var: %v>", err)
-		}
-		sb.WriteString(text)
-	}
-	return sb.String()
+	return e.String()
 }
 
 func numbervars(n int) []Term {
@@ -203,16 +169,36 @@ func numbervars(n int) []Term {
 	return vars
 }
 
-func unmarshalTerm(bs []byte) (Term, error) {
+// unmarshalTerm decodes a term from JSON with d.
+func unmarshalTerm(bs []byte, d termDecoder) (Term, error) {
 	var iface any
 	dec := json.NewDecoder(bytes.NewReader(bs))
 	dec.UseNumber()
 	if err := dec.Decode(&iface); err != nil {
 		return nil, err
 	}
+	return d.decodeTerm(iface, 1)
+}
+
+// termDecoder converts decoded JSON into terms.
+type termDecoder struct {
+	// maxDepth fails terms nested deeper than it (0 for no limit)
+	maxDepth int
+	// text decodes strings as Chars and lists of codes as Codes, see WithTextLists
+	text bool
+}
+
+// decodeTerm converts decoded JSON into a term.
+func (d termDecoder) decodeTerm(iface any, depth int) (Term, error) {
+	if d.maxDepth > 0 && depth > d.maxDepth {
+		return nil, fmt.Errorf("%w (max depth: %d)", ErrTooDeep, d.maxDepth)
+	}
 
 	switch x := iface.(type) {
 	case string:
+		if d.text {
+			return Chars(x), nil
+		}
 		return x, nil
 	case json.Number:
 		str := string(x)
@@ -221,79 +207,49 @@ func unmarshalTerm(bs []byte) (Term, error) {
 		}
 		return strconv.ParseInt(str, 10, 64)
 	case []any:
-		var raws []json.RawMessage
-		dec := json.NewDecoder(bytes.NewReader(bs))
-		dec.UseNumber()
-		if err := dec.Decode(&raws); err != nil {
+		list, err := d.decodeTerms(x, depth)
+		if err != nil {
 			return nil, err
 		}
-		list := make([]Term, 0, len(raws))
-		for _, raw := range raws {
-			term, err := unmarshalTerm(raw)
-			if err != nil {
-				return nil, err
+		if d.text {
+			if codes, ok := codeList(list); ok {
+				return codes, nil
 			}
-			list = append(list, term)
 		}
 		return list, nil
 	case map[string]any:
-		var raws map[string]json.RawMessage
-		dec := json.NewDecoder(bytes.NewReader(bs))
-		dec.UseNumber()
-		if err := dec.Decode(&raws); err != nil {
-			return nil, err
-		}
-
-		var term struct {
-			Functor Atom
-			Args    []json.RawMessage
-			Var     string
-			Attr    []json.RawMessage
-			Number  string
-		}
-		dec = json.NewDecoder(bytes.NewReader(bs))
-		dec.UseNumber()
-		if err := dec.Decode(&term); err != nil {
-			return nil, err
-		}
-
-		if term.Number != "" {
+		if number, ok := x["number"].(string); ok && number != "" {
 			n := new(big.Int)
-			if _, ok := n.SetString(term.Number, 10); !ok {
-				return nil, fmt.Errorf("trealla: failed to decode number: %s", term.Number)
+			if _, ok := n.SetString(number, 10); !ok {
+				return nil, fmt.Errorf("trealla: failed to decode number: %s", number)
 			}
 			return n, nil
 		}
 
-		if term.Var != "" {
-			attr := make([]Term, 0, len(term.Attr))
-			for _, raw := range term.Attr {
-				at, err := unmarshalTerm(raw)
-				if err != nil {
-					return nil, err
-				}
-				attr = append(attr, at)
+		if name, ok := x["var"].(string); ok && name != "" {
+			attrs, _ := x["attr"].([]any)
+			attr, err := d.decodeTerms(attrs, depth)
+			if err != nil {
+				return nil, err
 			}
 			if len(attr) == 0 {
 				attr = nil
 			}
-			return Variable{Name: term.Var, Attr: attr}, nil
+			return Variable{Name: name, Attr: attr}, nil
 		}
 
-		if len(term.Args) == 0 {
-			return Atom(term.Functor), nil
+		// [] is the empty atom
+		functor, _ := x["functor"].(string)
+		raws, _ := x["args"].([]any)
+		if len(raws) == 0 {
+			return Atom(functor), nil
 		}
-
-		args := make([]Term, 0, len(term.Args))
-		for _, raw := range term.Args {
-			arg, err := unmarshalTerm(raw)
-			if err != nil {
-				return nil, err
-			}
-			args = append(args, arg)
+		args, err := d.decodeTerms(raws, depth)
+		if err != nil {
+			return nil, err
 		}
 		return Compound{
-			Functor: term.Functor,
+			Functor: Atom(functor),
 			Args:    args,
 		}, nil
 	case bool:
@@ -304,3 +260,31 @@ func unmarshalTerm(bs []byte) (Term, error) {
 
 	return nil, fmt.Errorf("trealla: unhandled term json: %T %v", iface, iface)
 }
+
+// codeList converts a non-empty list of character codes.
+func codeList(list []Term) (Codes, bool) {
+	if len(list) == 0 {
+		return "", false
+	}
+	var sb strings.Builder
+	for _, elem := range list {
+		code, ok := elem.(int64)
+		if !ok || code < 0 || code > unicode.MaxRune || !utf8.ValidRune(rune(code)) {
+			return "", false
+		}
+		sb.WriteRune(rune(code))
+	}
+	return Codes(sb.String()), true
+}
+
+func (d termDecoder) decodeTerms(raws []any, depth int) ([]Term, error) {
+	list := make([]Term, 0, len(raws))
+	for _, raw := range raws {
+		term, err := d.decodeTerm(raw, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, term)
+	}
+	return list, nil
+}
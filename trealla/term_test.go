@@ -1,8 +1,13 @@
 package trealla
 
 import (
+	"context"
+	"errors"
 	"math/big"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCompound(t *testing.T) {
@@ -85,6 +90,26 @@ func TestMarshal(t *testing.T) {
 			term: coordinate{Functor: "/", X: 6, Y: 9},
 			want: "6/9",
 		},
+		{
+			term: apiRequest{User: "alice", Tags: []string{"a"}, Limit: 10},
+			want: `['='(user, "alice"), '='('Tags', ["a"]), '='('Limit', 10)]`,
+		},
+		{
+			term: map[string]int{"b": 2, "a": 1},
+			want: "['='(a, 1), '='(b, 2)]",
+		},
+		{
+			term: Chars("a'b"),
+			want: `[a, '\'', b]`,
+		},
+		{
+			term: Codes("hé"),
+			want: "[104, 233]",
+		},
+		{
+			term: Chars(""),
+			want: "[]",
+		},
 	}
 
 	for _, tc := range cases {
@@ -100,8 +125,299 @@ func TestMarshal(t *testing.T) {
 	}
 }
 
+type apiRequest struct {
+	User   string `prolog:"user"`
+	Tags   []string
+	Limit  int
+	secret string
+	Skip   bool `prolog:"-"`
+}
+
+// level is written by name, through encoding.TextMarshaler
+type level int
+
+func (l level) MarshalText() ([]byte, error) {
+	return []byte([]string{"low", "high"}[l]), nil
+}
+
+func TestMarshalStructs(t *testing.T) {
+	req := apiRequest{User: "alice", Tags: []string{"a", "b"}, Limit: 10}
+
+	text, err := Marshal(req, WithMarshalStructs(StructCompound))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `api_request("alice", ["a", "b"], 10)`; text != want {
+		t.Error("want:", want, "got:", text)
+	}
+
+	if _, err := Marshal(map[int]int{1: 2}); err == nil {
+		t.Error("expected error for non-string keys")
+	}
+
+	if _, err := Marshal(struct{ secret int }{1}); err == nil {
+		t.Error("expected error for struct without exported fields")
+	}
+	when := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if text, err := Marshal(when); err != nil || text != `"2024-01-02T03:04:05Z"` {
+		t.Error("bad time:", text, err)
+	}
+	if text, err := Marshal([]level{0, 1}); err != nil || text != `["low","high"]` {
+		t.Error("bad text marshaler:", text, err)
+	}
+
+	for name, want := range map[string]string{"APIRequest": "api_request", "userID": "user_id", "Plain": "plain"} {
+		if got := snakeCase(name); got != want {
+			t.Error("want:", want, "got:", got)
+		}
+	}
+
+	t.Run("Scan", func(t *testing.T) {
+		pl, err := New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pl.Close()
+
+		ans, err := pl.QueryOnce(context.Background(), `
+			member(user=U, Req), Out = [user=U, 'Limit'=20, tags=["x"]],
+			Compound = api_request("bob", [], 3).`, WithBind("Req", req))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result struct {
+			Out      apiRequest
+			Req      map[string]Term
+			Compound apiRequest
+		}
+		if err := ans.Solution.Scan(&result); err != nil {
+			t.Fatal(err)
+		}
+		if want := (apiRequest{User: "alice", Tags: []string{"x"}, Limit: 20}); !reflect.DeepEqual(result.Out, want) {
+			t.Errorf("want: %+v got: %+v", want, result.Out)
+		}
+		wantMap := map[string]Term{"user": "alice", "Tags": []Term{"a", "b"}, "Limit": int64(10)}
+		if !reflect.DeepEqual(result.Req, wantMap) {
+			t.Errorf("want: %#v got: %#v", wantMap, result.Req)
+		}
+		if want := (apiRequest{User: "bob", Tags: []string{}, Limit: 3}); !reflect.DeepEqual(result.Compound, want) {
+			t.Errorf("want: %+v got: %+v", want, result.Compound)
+		}
+
+		// options after a comma aren't part of the name, as with Marshal
+		var tagged struct {
+			User string `prolog:"Out.user,opt"`
+			Skip string `prolog:"-"`
+		}
+		if err := ans.Solution.Scan(&tagged); err != nil {
+			t.Fatal(err)
+		}
+		if tagged.User != "alice" {
+			t.Error("want: alice got:", tagged.User)
+		}
+	})
+}
+
 // compound of X/Y
 type coordinate struct {
 	Functor `prolog:"//2"`
 	X, Y    int
 }
+
+func TestMarshalLimits(t *testing.T) {
+	t.Run("cycle", func(t *testing.T) {
+		list := make([]any, 1)
+		list[0] = list
+		if _, err := Marshal(list); !errors.Is(err, ErrCycle) {
+			t.Error("want ErrCycle, got:", err)
+		}
+
+		c := Atom("f").Of(nil)
+		c.Args[0] = c
+		if _, err := Marshal(c); !errors.Is(err, ErrCycle) {
+			t.Error("want ErrCycle, got:", err)
+		}
+		if str := c.String(); !strings.Contains(str, "<invalid: ") {
+			t.Error("want invalid placeholder, got:", str)
+		}
+	})
+
+	t.Run("depth", func(t *testing.T) {
+		var term Term = Atom("x")
+		for range 20 {
+			term = Atom("s").Of(term)
+		}
+		if _, err := Marshal(term, WithMarshalMaxDepth(10)); !errors.Is(err, ErrTooDeep) {
+			t.Error("want ErrTooDeep, got:", err)
+		}
+		if _, err := Marshal(term, WithMarshalMaxDepth(21)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("size", func(t *testing.T) {
+		if _, err := Marshal([]Term{"hello", "world"}, WithMarshalMaxSize(10)); !errors.Is(err, ErrTooLarge) {
+			t.Error("want ErrTooLarge, got:", err)
+		}
+		if _, err := Marshal([]Term{"hello", "world"}, WithMarshalMaxSize(100)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("unmarshal depth", func(t *testing.T) {
+		var nested any = "x"
+		for range DefaultMaxDepth + 1 {
+			nested = []any{nested}
+		}
+		if _, err := (termDecoder{maxDepth: DefaultMaxDepth}).decodeTerm(nested, 1); !errors.Is(err, ErrTooDeep) {
+			t.Error("want ErrTooDeep, got:", err)
+		}
+		if _, err := (termDecoder{}).decodeTerm(nested, 1); err != nil {
+			t.Error("unlimited:", err)
+		}
+	})
+
+	t.Run("internal marshaling", func(t *testing.T) {
+		var term Term = Atom("x")
+		for range DefaultMaxDepth + 1 {
+			term = Atom("s").Of(term)
+		}
+		if _, err := Marshal(term); !errors.Is(err, ErrTooDeep) {
+			t.Error("want ErrTooDeep, got:", err)
+		}
+		if _, err := marshal(term); err != nil {
+			t.Error(err)
+		}
+		if str := term.(Compound).String(); strings.Contains(str, "<invalid") {
+			t.Error("unexpected invalid term")
+		}
+	})
+
+	t.Run("interpreter depth", func(t *testing.T) {
+		pl, err := New(WithMaxDepth(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pl.Close()
+		ctx := context.Background()
+		if _, err := pl.QueryOnce(ctx, "X = s(s(s(s(s(s(0))))))."); !errors.Is(err, ErrTooDeep) {
+			t.Error("want ErrTooDeep, got:", err)
+		}
+		if _, err := pl.QueryOnce(ctx, "X = s(s(0))."); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("default interpreter depth", func(t *testing.T) {
+		pl, err := New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pl.Close()
+		ctx := context.Background()
+		if err := pl.ConsultText(ctx, "user", "nest(0, z) :- !.\nnest(N, s(T)) :- N1 is N - 1, nest(N1, T)."); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pl.QueryOnce(ctx, "nest(N, X).", WithBind("N", DefaultMaxDepth)); !errors.Is(err, ErrTooDeep) {
+			t.Error("want ErrTooDeep, got:", err)
+		}
+		if _, err := pl.QueryOnce(ctx, "nest(N, X).", WithBind("N", DefaultMaxDepth-1)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("bind", func(t *testing.T) {
+		pl, err := New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pl.Close()
+		list := make([]any, 1)
+		list[0] = list
+		if _, err := pl.QueryOnce(context.Background(), "true.", WithBind("X", list)); !errors.Is(err, ErrCycle) {
+			t.Error("want ErrCycle, got:", err)
+		}
+	})
+}
+
+func TestCharsCodes(t *testing.T) {
+	ctx := context.Background()
+	pl, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Close()
+
+	ans, err := pl.QueryOnce(ctx, `atom_chars(A, Chars), atom_codes(B, Codes), Empty = [], Str = "xyz".`,
+		WithBind("Chars", Chars("héllo")), WithBind("Codes", Codes("wörld")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := ans.Solution["A"]; a != Atom("héllo") {
+		t.Error("want: héllo got:", a)
+	}
+	if b := ans.Solution["B"]; b != Atom("wörld") {
+		t.Error("want: wörld got:", b)
+	}
+
+	var result struct {
+		Chars Chars
+		Codes Codes
+		Empty Codes
+		Str   Codes
+	}
+	if err := ans.Solution.Scan(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Chars != "héllo" || result.Codes != "wörld" || result.Empty != "" || result.Str != "xyz" {
+		t.Errorf("bad scan: %+v", result)
+	}
+
+	bad := Substitution{"Chars": []Term{Atom("a"), int64(98)}}
+	if err := bad.Scan(&result); err == nil {
+		t.Error("expected error for mixed list")
+	}
+
+	var runes struct {
+		Chars []rune
+		Codes []rune
+		Str   []rune
+	}
+	if err := ans.Solution.Scan(&runes); err != nil {
+		t.Fatal(err)
+	}
+	if string(runes.Chars) != "héllo" || string(runes.Codes) != "wörld" || string(runes.Str) != "xyz" {
+		t.Errorf("bad scan: %+v", runes)
+	}
+
+	t.Run("WithTextLists", func(t *testing.T) {
+		pl, err := New(WithTextLists())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pl.Close()
+		ans, err := pl.QueryOnce(ctx, `atom_chars(héllo, Chars), atom_codes(wörld, Codes), Nums = [1, -2], Empty = [].`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Substitution{
+			"Chars": Chars("héllo"),
+			"Codes": Codes("wörld"),
+			"Nums":  []Term{int64(1), int64(-2)},
+			"Empty": []Term{},
+		}
+		if !reflect.DeepEqual(want, ans.Solution) {
+			t.Errorf("want: %#v got: %#v", want, ans.Solution)
+		}
+		var result struct {
+			Codes []Term
+			Chars string
+		}
+		if err := ans.Solution.Scan(&result); err != nil {
+			t.Fatal(err)
+		}
+		if want := []Term{int64('w'), int64('ö'), int64('r'), int64('l'), int64('d')}; !reflect.DeepEqual(want, result.Codes) || result.Chars != "héllo" {
+			t.Errorf("bad scan: %+v", result)
+		}
+	})
+}
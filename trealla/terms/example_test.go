@@ -2,6 +2,7 @@ package terms_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"iter"
 
@@ -73,3 +74,43 @@ func Example_nondet_predicate() {
 	fmt.Println(answer.Stdout)
 	// Output: [1,2,3,4,5]
 }
+
+func ExampleDecodeOptions() {
+	ctx := context.Background()
+	pl, err := trealla.New()
+	if err != nil {
+		panic(err)
+	}
+
+	// greet(+Name, +Options) writes a greeting.
+	pl.Register(ctx, "greet", 2, func(_ trealla.Prolog, _ trealla.Subquery, goal0 trealla.Term) trealla.Term {
+		goal := goal0.(trealla.Compound)
+		// Set defaults before decoding.
+		opts := struct {
+			Greeting string `prolog:"greeting"`
+			Times    int    `prolog:"times"`
+		}{Greeting: "hello", Times: 1}
+		if err := terms.DecodeOptions(goal.Args[1], &opts); err != nil {
+			var optErr trealla.OptionError
+			if errors.As(err, &optErr) {
+				// throw(error(domain_error(option, ...), greet/2)), etc.
+				return optErr.Throw(terms.PI(goal))
+			}
+			return terms.Throw(terms.SystemError(err.Error(), terms.PI(goal)))
+		}
+		for range opts.Times {
+			fmt.Println(opts.Greeting, goal.Args[0])
+		}
+		return goal
+	})
+
+	if _, err := pl.QueryOnce(ctx, `greet(world, [times(2), greeting("hi")]).`); err != nil {
+		panic(err)
+	}
+	_, err = pl.QueryOnce(ctx, `greet(world, [volume(11)]).`)
+	fmt.Println(err)
+	// Output:
+	// hi world
+	// hi world
+	// trealla: exception thrown: error(domain_error(option, volume(11)), greet/2)
+}
@@ -0,0 +1,145 @@
+package terms
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/trealla-prolog/go/trealla"
+)
+
+// GoOption is an option for [ToGo].
+type GoOption func(*goOptions)
+
+type goOptions struct {
+	atom func(trealla.Atom) any
+}
+
+// WithAtoms sets the function used by [ToGo] to convert atoms.
+// By default, atoms are kept as [trealla.Atom].
+// See [StringAtom] and [JSONAtom].
+func WithAtoms(convert func(trealla.Atom) any) GoOption {
+	return func(opts *goOptions) {
+		opts.atom = convert
+	}
+}
+
+// StringAtom converts an atom to a string. For use with [WithAtoms].
+func StringAtom(a trealla.Atom) any {
+	return string(a)
+}
+
+// JSONAtom converts true and false to bools, null to nil, and other atoms to strings. For use with [WithAtoms].
+func JSONAtom(a trealla.Atom) any {
+	switch a {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	return string(a)
+}
+
+// ToGo converts t to a natural Go value, following the same rules as [trealla.Substitution.Scan] for fields of type any:
+//   - strings, int64, float64, and *big.Int are unchanged
+//   - lists of Key=Value or Key-Value pairs and json(Pairs) become map[string]any, unless a key repeats
+//   - other lists become []any, so pairs with repeated keys are kept as they are
+//   - unbound variables become nil
+//   - atoms are converted as configured by [WithAtoms]
+//   - other compounds are unchanged
+//
+// It returns the error of [trealla.Natural] if t can't be converted.
+func ToGo(t trealla.Term, options ...GoOption) (any, error) {
+	var opts goOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	v, err := trealla.Natural(t)
+	if err != nil {
+		return nil, err
+	}
+	if opts.atom == nil {
+		return v, nil
+	}
+	return convertAtoms(v, opts.atom), nil
+}
+
+func convertAtoms(v any, convert func(trealla.Atom) any) any {
+	switch x := v.(type) {
+	case trealla.Atom:
+		return convert(x)
+	case []any:
+		for i, elem := range x {
+			x[i] = convertAtoms(elem, convert)
+		}
+	case map[string]any:
+		for k, elem := range x {
+			x[k] = convertAtoms(elem, convert)
+		}
+	}
+	return v
+}
+
+// FromGo converts a natural Go value to a term, reversing [ToGo]:
+//   - nil becomes an unbound variable
+//   - bools become the atoms true and false
+//   - integers become int64 (or *big.Int if they don't fit), and floats become float64
+//   - slices become lists
+//   - maps with string keys become lists of Key=Value pairs, sorted by key
+//
+// Strings, terms, and other values are unchanged.
+func FromGo(v any) trealla.Term {
+	switch x := v.(type) {
+	case nil:
+		return trealla.Variable{Name: "_"}
+	case bool:
+		if x {
+			return trealla.Atom("true")
+		}
+		return trealla.Atom("false")
+	case string, int64, float64, *big.Int, trealla.Atom, trealla.Compound, trealla.Variable, Chars, Codes:
+		return x
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n := rv.Uint(); n > math.MaxInt64 {
+			return new(big.Int).SetUint64(n)
+		}
+		return int64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return []trealla.Term{}
+		}
+		list := make([]trealla.Term, rv.Len())
+		for i := range list {
+			list[i] = FromGo(rv.Index(i).Interface())
+		}
+		return list
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		keys := rv.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int {
+			return strings.Compare(a.String(), b.String())
+		})
+		pairs := make([]trealla.Term, len(keys))
+		for i, k := range keys {
+			pairs[i] = trealla.Atom("=").Of(trealla.Atom(k.String()), FromGo(rv.MapIndex(k).Interface()))
+		}
+		return pairs
+	}
+	return v
+}
@@ -0,0 +1,142 @@
+package terms_test
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/trealla-prolog/go/trealla"
+	"github.com/trealla-prolog/go/trealla/terms"
+)
+
+func TestToGo(t *testing.T) {
+	big := new(big.Int).Lsh(big.NewInt(1), 100)
+	table := []struct {
+		name    string
+		in      trealla.Term
+		options []terms.GoOption
+		out     any
+	}{
+		{name: "string", in: "hello", out: "hello"},
+		{name: "int", in: int64(42), out: int64(42)},
+		{name: "float", in: 1.5, out: 1.5},
+		{name: "bigint", in: big, out: big},
+		{name: "atom", in: trealla.Atom("abc"), out: trealla.Atom("abc")},
+		{name: "atom as string", in: trealla.Atom("abc"), options: []terms.GoOption{terms.WithAtoms(terms.StringAtom)}, out: "abc"},
+		{name: "variable", in: trealla.Variable{Name: "X"}, out: nil},
+		{name: "empty list", in: []trealla.Term{}, out: []any{}},
+		{
+			name: "list",
+			in:   []trealla.Term{int64(1), "two", []trealla.Term{trealla.Atom("three")}},
+			out:  []any{int64(1), "two", []any{trealla.Atom("three")}},
+		},
+		{
+			name: "pairs",
+			in:   []trealla.Term{trealla.Atom("=").Of(trealla.Atom("a"), int64(1)), trealla.Atom("-").Of("b", []trealla.Term{})},
+			out:  map[string]any{"a": int64(1), "b": []any{}},
+		},
+		{
+			name:    "json",
+			in:      trealla.Atom("json").Of([]trealla.Term{trealla.Atom("-").Of("ok", trealla.Atom("true")), trealla.Atom("-").Of("v", trealla.Atom("null"))}),
+			options: []terms.GoOption{terms.WithAtoms(terms.JSONAtom)},
+			out:     map[string]any{"ok": true, "v": nil},
+		},
+		{
+			name: "repeated keys",
+			in:   []trealla.Term{trealla.Atom("=").Of(trealla.Atom("a"), int64(1)), trealla.Atom("=").Of(trealla.Atom("a"), int64(2))},
+			out:  []any{trealla.Atom("=").Of(trealla.Atom("a"), int64(1)), trealla.Atom("=").Of(trealla.Atom("a"), int64(2))},
+		},
+		{
+			name: "json with repeated keys",
+			in:   trealla.Atom("json").Of([]trealla.Term{trealla.Atom("-").Of("k", int64(1)), trealla.Atom("-").Of("k", int64(2))}),
+			out:  trealla.Atom("json").Of([]trealla.Term{trealla.Atom("-").Of("k", int64(1)), trealla.Atom("-").Of("k", int64(2))}),
+		},
+		{name: "empty json", in: trealla.Atom("json").Of([]trealla.Term{}), out: map[string]any{}},
+		{name: "compound", in: trealla.Atom("f").Of(trealla.Atom("x")), out: trealla.Atom("f").Of(trealla.Atom("x"))},
+	}
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := terms.ToGo(tc.in, tc.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tc.out, got) {
+				t.Errorf("want: %#v got: %#v", tc.out, got)
+			}
+		})
+	}
+}
+
+func TestFromGo(t *testing.T) {
+	table := []struct {
+		name string
+		in   any
+		out  trealla.Term
+	}{
+		{name: "nil", in: nil, out: trealla.Variable{Name: "_"}},
+		{name: "bool", in: true, out: trealla.Atom("true")},
+		{name: "int", in: 42, out: int64(42)},
+		{name: "uint8", in: uint8(7), out: int64(7)},
+		{name: "float32", in: float32(0.5), out: 0.5},
+		{name: "string", in: "hi", out: "hi"},
+		{name: "slice", in: []int{1, 2}, out: []trealla.Term{int64(1), int64(2)}},
+		{
+			name: "map",
+			in:   map[string]any{"b": []any{true}, "a": 1.5},
+			out: []trealla.Term{
+				trealla.Atom("=").Of(trealla.Atom("a"), 1.5),
+				trealla.Atom("=").Of(trealla.Atom("b"), []trealla.Term{trealla.Atom("true")}),
+			},
+		},
+		{name: "term", in: trealla.Atom("f").Of(int64(1)), out: trealla.Atom("f").Of(int64(1))},
+	}
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			got := terms.FromGo(tc.in)
+			if !reflect.DeepEqual(tc.out, got) {
+				t.Errorf("want: %#v got: %#v", tc.out, got)
+			}
+		})
+	}
+}
+
+func TestNaturalRoundTrip(t *testing.T) {
+	pl, err := trealla.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pl.Close()
+
+	doc := map[string]any{
+		"name": "alice",
+		"age":  int64(30),
+		"tags": []any{"a", "b"},
+		"address": map[string]any{
+			"city": "Tokyo",
+		},
+	}
+	ans, err := pl.QueryOnce(context.Background(), `member(address=A, Doc), member(city=City, A).`, trealla.WithBind("Doc", terms.FromGo(doc)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Doc  map[string]any
+		City any
+	}
+	if err := ans.Solution.Scan(&result); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.Doc, doc) {
+		t.Errorf("want: %#v got: %#v", doc, result.Doc)
+	}
+	if result.City != "Tokyo" {
+		t.Error("want: Tokyo got:", result.City)
+	}
+	if got, err := terms.ToGo(ans.Solution["Doc"]); err != nil || !reflect.DeepEqual(got, doc) {
+		t.Errorf("want: %#v got: %#v (%v)", doc, got, err)
+	}
+	if _, err := terms.ToGo(nil); err == nil {
+		t.Error("expected error for nil term")
+	}
+}
@@ -89,6 +89,14 @@ func ResolveOption[T trealla.Term](opts trealla.Term, functor trealla.Atom, fall
 	return fallback
 }
 
+// DecodeOptions fills the struct pointed to by dst from an options list in the form of `[foo(V1), bar(V2), ...]`.
+// Unlike [ResolveOption], it validates the whole list and never modifies it.
+// Invalid options are reported as [trealla.OptionError]; use its Throw method to raise the error from a predicate.
+// See [trealla.DecodeOptions] for details.
+func DecodeOptions(opts trealla.Term, dst any) error {
+	return trealla.DecodeOptions(opts, dst)
+}
+
 func IsList(x trealla.Term) bool {
 	switch x := x.(type) {
 	case string, []trealla.Term, []any, []string, []int64, []int, []float64, []*big.Int, []trealla.Atom, []trealla.Compound, []trealla.Variable:
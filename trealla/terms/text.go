@@ -0,0 +1,62 @@
+package terms
+
+import (
+	"github.com/trealla-prolog/go/trealla"
+)
+
+// Chars is text represented as a list of one-character atoms, such as [a, b, c].
+// See [trealla.Chars].
+type Chars = trealla.Chars
+
+// Codes is text represented as a list of character codes, such as [97, 98, 99].
+// See [trealla.Codes].
+type Codes = trealla.Codes
+
+// TextKind is the representation Prolog used for text.
+type TextKind int
+
+const (
+	// NotText is a term that isn't text.
+	NotText TextKind = iota
+	// StringText is a string such as "abc", including the empty list.
+	// Trealla stores these as packed lists of characters, so char lists returned by queries are strings too,
+	// unless the interpreter was created with [trealla.WithTextLists].
+	StringText
+	// CharsText is a list of one-character atoms, such as [a, b, c].
+	CharsText
+	// CodesText is a list of character codes, such as [97, 98, 99].
+	CodesText
+	// AtomText is an atom, as produced by double-quoted text when the double_quotes flag is atom.
+	AtomText
+)
+
+// Text returns the text held by t and the representation it used.
+// It returns NotText if t is not a string, atom, [Chars], [Codes], or a list of characters or codes.
+func Text(t trealla.Term) (string, TextKind) {
+	text, ok := trealla.Text(t)
+	if !ok {
+		return "", NotText
+	}
+	switch x := t.(type) {
+	case string:
+		return text, StringText
+	case Chars:
+		return text, CharsText
+	case Codes:
+		return text, CodesText
+	case trealla.Atom:
+		if x == "[]" {
+			return text, StringText
+		}
+		return text, AtomText
+	case []trealla.Term:
+		if len(x) == 0 {
+			return text, StringText
+		}
+		if _, ok := x[0].(int64); ok {
+			return text, CodesText
+		}
+		return text, CharsText
+	}
+	return "", NotText
+}
@@ -0,0 +1,34 @@
+package terms_test
+
+import (
+	"testing"
+
+	"github.com/trealla-prolog/go/trealla"
+	"github.com/trealla-prolog/go/trealla/terms"
+)
+
+func TestText(t *testing.T) {
+	table := []struct {
+		in   trealla.Term
+		text string
+		kind terms.TextKind
+	}{
+		{in: "abc", text: "abc", kind: terms.StringText},
+		{in: trealla.Atom("[]"), text: "", kind: terms.StringText},
+		{in: []trealla.Term{trealla.Atom("a"), trealla.Atom("b")}, text: "ab", kind: terms.CharsText},
+		{in: []trealla.Term{int64(97), int64(98)}, text: "ab", kind: terms.CodesText},
+		{in: terms.Chars("xy"), text: "xy", kind: terms.CharsText},
+		{in: terms.Codes("xy"), text: "xy", kind: terms.CodesText},
+		{in: trealla.Atom("abc"), text: "abc", kind: terms.AtomText},
+		{in: []trealla.Term{trealla.Atom("ab")}, kind: terms.NotText},
+		{in: []trealla.Term{int64(97), trealla.Atom("b")}, kind: terms.NotText},
+		{in: trealla.Atom("f").Of("x"), kind: terms.NotText},
+		{in: int64(1), kind: terms.NotText},
+	}
+	for _, tc := range table {
+		text, kind := terms.Text(tc.in)
+		if text != tc.text || kind != tc.kind {
+			t.Errorf("%v: want: %q, %v got: %q, %v", tc.in, tc.text, tc.kind, text, kind)
+		}
+	}
+}
@@ -14,31 +14,76 @@ var tplWASM []byte
 
 type wasmFunc = api.Function
 
-var wasmEngine wazero.Runtime
-var wasmModule wazero.CompiledModule
+// Runtime is a WebAssembly runtime that interpreters are instantiated in.
+// By default, interpreters use a shared runtime with wazero's default configuration.
+// Use [NewRuntime] and [WithRuntime] to configure it.
+type Runtime struct {
+	engine wazero.Runtime
+	module wazero.CompiledModule
+}
+
+var defaultRuntime *Runtime
 
 func init() {
-	ctx := context.Background()
-	wasmEngine = wazero.NewRuntime(ctx)
-	wasi_snapshot_preview1.MustInstantiate(ctx, wasmEngine)
+	var err error
+	defaultRuntime, err = NewRuntime(context.Background(), wazero.NewRuntimeConfig())
+	if err != nil {
+		panic(err)
+	}
+}
+
+// NewRuntime creates a runtime with the given wazero configuration,
+// such as the choice of compiler or interpreter engine, memory limits, and debug info.
+// With [wazero.RuntimeConfig.WithCloseOnContextDone], closing an interpreter stops any Wasm code it is running.
+//
+// The Trealla module is compiled using ctx, so function listeners
+// added with [github.com/tetratelabs/wazero/experimental.WithFunctionListenerFactory] apply to it.
+func NewRuntime(ctx context.Context, cfg wazero.RuntimeConfig) (*Runtime, error) {
+	engine := wazero.NewRuntimeWithConfig(ctx, cfg)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, engine); err != nil {
+		engine.Close(ctx)
+		return nil, err
+	}
 
-	_, err := wasmEngine.NewHostModuleBuilder("trealla").
+	_, err := engine.NewHostModuleBuilder("trealla").
 		NewFunctionBuilder().WithFunc(hostCall).Export("host-call").
 		NewFunctionBuilder().WithFunc(hostResume).Export("host-resume").
 		Instantiate(ctx)
 	if err != nil {
-		panic(err)
+		engine.Close(ctx)
+		return nil, err
 	}
 
-	wasmModule, err = wasmEngine.CompileModule(ctx, tplWASM)
+	module, err := engine.CompileModule(ctx, tplWASM)
 	if err != nil {
-		panic(err)
+		engine.Close(ctx)
+		return nil, err
+	}
+	return &Runtime{engine: engine, module: module}, nil
+}
+
+// New creates a new Prolog interpreter in this runtime.
+func (rt *Runtime) New(options ...Option) (Prolog, error) {
+	return New(append([]Option{WithRuntime(rt)}, options...)...)
+}
+
+// Close destroys the runtime along with every interpreter in it.
+func (rt *Runtime) Close(ctx context.Context) error {
+	return rt.engine.Close(ctx)
+}
+
+// WithRuntime creates the interpreter in the given runtime instead of the default one.
+// Clones are created in the same runtime.
+func WithRuntime(rt *Runtime) Option {
+	return func(pl *prolog) {
+		pl.rt = rt
 	}
 }
 
 var (
 	wasmFalse uint32 = 0
 	wasmTrue  uint32 = 1
+	wasmYield uint32 = 2
 )
 
 const (
@@ -0,0 +1,43 @@
+package trealla
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tetratelabs/wazero"
+)
+
+func TestRuntime(t *testing.T) {
+	ctx := context.Background()
+	rt, err := NewRuntime(ctx, wazero.NewRuntimeConfigInterpreter().WithMemoryLimitPages(4096))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pl, err := rt.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pl.QueryOnce(ctx, `X = 1.`); err != nil {
+		t.Fatal(err)
+	}
+	clone, err := pl.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := clone.(*prolog).rt; got != rt {
+		t.Error("clone in wrong runtime:", got)
+	}
+
+	// memory limit
+	if _, err := pl.QueryOnce(ctx, `length(L, 100000000).`); err == nil {
+		t.Error("expected memory limit to be hit")
+	}
+
+	if err := rt.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clone.QueryOnce(ctx, `true.`); err == nil {
+		t.Error("expected error after runtime was closed")
+	}
+}